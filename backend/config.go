@@ -0,0 +1,47 @@
+package functions
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+// embeddedConfig is the default config, see lib.LoadConfig for overriding it.
+//
+//go:embed config.json
+var embeddedConfig []byte
+
+// appConfig is loaded when the instance starts, an invalid config stops it
+// from serving anything.
+var appConfig = mustLoadConfig()
+
+// activeRegions are the regions observations are fetched for.
+var activeRegions = appConfig.Active()
+
+// observationBoundingBox covers all active regions.
+var observationBoundingBox = activeRegions.BoundingBox()
+
+// webcamHealthPolicy decides when webcams are reported stale, broken or dark.
+var webcamHealthPolicy = appConfig.WebcamHealthPolicy()
+
+func mustLoadConfig() *lib.Config {
+	config, err := lib.LoadConfig(embeddedConfig)
+	if err == nil {
+		err = validateSmhiParameters(config.Providers.Smhi.Parameters)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	return config
+}
+
+func validateSmhiParameters(parameters []int) error {
+	for i, parameter := range parameters {
+		if _, ok := measurementProperties[parameter]; !ok {
+			return fmt.Errorf("providers.smhi.parameters[%d]: unsupported parameter %d", i, parameter)
+		}
+	}
+	return nil
+}
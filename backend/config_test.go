@@ -0,0 +1,58 @@
+package functions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func TestJamtlandCoversBaselineBoundingBox(t *testing.T) {
+	// The bounding box observations were fetched in before regions were configurable
+	baseline := lib.BoundingBox{MinLongitude: 11.91821627146622, MinLatitude: 61.72869520035822, MaxLongitude: 18.493133525180227, MaxLatitude: 64.42201973845242}
+	var jamtland lib.Regions
+	for _, region := range activeRegions {
+		if region.Name == "jamtland" {
+			jamtland = append(jamtland, region)
+		}
+	}
+	if len(jamtland) == 0 {
+		t.Fatal("no jamtland region")
+	}
+
+	const steps = 20
+	for i := 0; i <= steps; i++ {
+		for j := 0; j <= steps; j++ {
+			longitude := baseline.MinLongitude + (baseline.MaxLongitude-baseline.MinLongitude)*float64(i)/steps
+			latitude := baseline.MinLatitude + (baseline.MaxLatitude-baseline.MinLatitude)*float64(j)/steps
+			if _, ok := jamtland.Locate(longitude, latitude); !ok {
+				t.Errorf("(%v, %v) is outside jamtland", longitude, latitude)
+			}
+		}
+	}
+}
+
+func TestValidateSmhiParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters []int
+		wantErr    string
+	}{
+		{"configured", appConfig.Providers.Smhi.Parameters, ""},
+		{"unsupported", []int{1, 999}, "providers.smhi.parameters[1]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSmhiParameters(test.parameters)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got %v, want an error with %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("fetchContours", FetchContours)
+}
+
+type contourSpec struct {
+	Property string
+	Levels   []float64
+}
+
+// publishedContours are regenerated after every ingestion run.
+var publishedContours = []contourSpec{
+	{Property: "temperature_c", Levels: []float64{-10, -5, 0, 5}},
+	{Property: "snowDepth_cm", Levels: []float64{25, 50, 100}},
+}
+
+// publishContours interpolates the current observations and stores the
+// contour lines of every published property, returning how many were published.
+func publishContours(ctx context.Context, stores *lib.Stores) (int, error) {
+	observations, err := stores.Observations.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing observations: %w", err)
+	}
+
+	columns, rows, err := parseGridSize(nil, observationBoundingBox)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var errs []error
+	for _, spec := range publishedContours {
+		selected := gridFilter(lib.ObservationFilter{}, spec.Property).Apply(observations, time.Now())
+		grid, err := interpolateGrid(selected, spec.Property, observationBoundingBox, columns, rows)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error interpolating %s: %w", spec.Property, err))
+			continue
+		}
+		collection := lib.ContourFeatureCollection(grid, spec.Property, spec.Levels)
+		if err := stores.Contours.PutContours(ctx, spec.Property, collection); err != nil {
+			errs = append(errs, fmt.Errorf("error storing %s contours: %w", spec.Property, err))
+			continue
+		}
+		log.Printf("Published %d %s contours", len(collection.Features), spec.Property)
+		published++
+	}
+	return published, errors.Join(errs...)
+}
+
+// FetchContours returns the contour lines published by the last ingestion run
+// as GeoJSON LineStrings, e.g. ?property=temperature_c. Every feature has the
+// property and level it traces.
+func FetchContours(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	property := r.URL.Query().Get("property")
+	if property == "" {
+		property = "temperature_c"
+	}
+
+	contours, err := lib.OpenContourStore(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open contour store: %v", err)
+		http.Error(w, "Failed to open contour store", http.StatusInternalServerError)
+		return
+	}
+	defer contours.Close()
+
+	collection, err := contours.GetContours(r.Context(), property)
+	if errors.Is(err, lib.ErrContoursNotFound) {
+		http.Error(w, fmt.Sprintf("no contours published for %q", property), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get %s contours: %v", property, err)
+		http.Error(w, "Failed to get contours", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(collection)
+}
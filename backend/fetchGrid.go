@@ -0,0 +1,192 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("fetchGrid", FetchGrid)
+}
+
+const (
+	defaultCellSizeKm = 2.5
+	maxGridCells      = 250000
+	// defaultGridMaxAge keeps stations that stopped reporting out of the grid.
+	defaultGridMaxAge = 6 * time.Hour
+)
+
+type gridResponse struct {
+	Property string     `json:"property"`
+	Bounds   [4]float64 `json:"bbox"`
+	Columns  int        `json:"columns"`
+	Rows     int        `json:"rows"`
+	// Values row by row from the north west corner, null where there is no estimate.
+	Values []*float64 `json:"values"`
+}
+
+// FetchGrid interpolates the observations into a continuous grid, e.g.
+// ?property=temperature_c&bbox=12,62,15,64&cellSizeKm=2&format=geojson
+//
+// property defaults to temperature_c. bbox defaults to the regions given by
+// region, or else all active regions.
+// format is geojson, one polygon per cell, or raw (default), the grid values
+// as a flat array. The observation filters of fetchObservations apply, maxAge
+// defaults to 6h.
+func FetchGrid(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	query := r.URL.Query()
+
+	property := query.Get("property")
+	if property == "" {
+		property = "temperature_c"
+	}
+	if !slices.Contains(lib.MeasurementProperties, property) {
+		http.Error(w, fmt.Sprintf("unknown property %q", property), http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "raw"
+	}
+	if format != "raw" && format != "geojson" {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseObservationFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bounds := observationBoundingBox
+	if filter.BoundingBox != nil {
+		bounds = *filter.BoundingBox
+	} else if len(filter.Regions) > 0 {
+		var regions lib.Regions
+		for _, region := range activeRegions {
+			if slices.Contains(filter.Regions, region.Name) {
+				regions = append(regions, region)
+			}
+		}
+		if len(regions) == 0 {
+			http.Error(w, fmt.Sprintf("no active region in %v", filter.Regions), http.StatusBadRequest)
+			return
+		}
+		bounds = regions.BoundingBox()
+	}
+
+	columns, rows, err := parseGridSize(query, bounds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	grid, err := buildGrid(r.Context(), property, bounds, columns, rows, filter)
+	if err != nil {
+		log.Printf("Failed to build %s grid: %v", property, err)
+		http.Error(w, "Failed to build grid", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if format == "geojson" {
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(grid.ToFeatureCollection(property))
+		return
+	}
+
+	response := gridResponse{
+		Property: property,
+		Bounds:   [4]float64{bounds.MinLongitude, bounds.MinLatitude, bounds.MaxLongitude, bounds.MaxLatitude},
+		Columns:  grid.Columns,
+		Rows:     grid.Rows,
+		Values:   make([]*float64, len(grid.Values)),
+	}
+	for i, value := range grid.Values {
+		if !math.IsNaN(value) {
+			rounded := math.Round(value*100) / 100
+			response.Values[i] = &rounded
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// buildGrid interpolates the property over the bounds from the observations
+// matching the filter.
+func buildGrid(ctx context.Context, property string, bounds lib.BoundingBox, columns int, rows int, filter lib.ObservationFilter) (*lib.Grid, error) {
+	observations, err := loadObservations(ctx, gridFilter(filter, property))
+	if err != nil {
+		return nil, err
+	}
+	return interpolateGrid(observations, property, bounds, columns, rows)
+}
+
+// gridFilter adapts the filter to select the observations a grid is
+// interpolated from. Observations outside the bounds are used as well, so
+// that the edges of the grid are estimated from both sides.
+func gridFilter(filter lib.ObservationFilter, property string) lib.ObservationFilter {
+	filter.BoundingBox = nil
+	if filter.MaxAge == 0 {
+		filter.MaxAge = defaultGridMaxAge
+	}
+	filter.NonNull = append(slices.Clone(filter.NonNull), property)
+	return filter
+}
+
+// interpolateGrid interpolates without a lapse rate correction, there is no
+// terrain elevation to bring the values back to.
+func interpolateGrid(observations []lib.Observation, property string, bounds lib.BoundingBox, columns int, rows int) (*lib.Grid, error) {
+	return lib.InterpolateIDW(observations, property, bounds, columns, rows, lib.DefaultInterpolationOptions)
+}
+
+// parseGridSize reads columns and rows, or derives them from cellSizeKm.
+func parseGridSize(query url.Values, bounds lib.BoundingBox) (int, int, error) {
+	cellSizeKm := defaultCellSizeKm
+	if value := query.Get("cellSizeKm"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return 0, 0, fmt.Errorf("invalid cellSizeKm %q", value)
+		}
+		cellSizeKm = parsed
+	}
+
+	const kmPerDegree = 111.32
+	centerLatitude := (bounds.MinLatitude + bounds.MaxLatitude) / 2 * math.Pi / 180
+	widthKm := (bounds.MaxLongitude - bounds.MinLongitude) * kmPerDegree * math.Cos(centerLatitude)
+	heightKm := (bounds.MaxLatitude - bounds.MinLatitude) * kmPerDegree
+	// Limit the float sizes before converting, a tiny cellSizeKm would overflow int
+	columns := max(1, int(math.Ceil(min(widthKm/cellSizeKm, maxGridCells+1))))
+	rows := max(1, int(math.Ceil(min(heightKm/cellSizeKm, maxGridCells+1))))
+
+	for name, target := range map[string]*int{"columns": &columns, "rows": &rows} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*target = parsed
+	}
+
+	// Divide rather than multiply, columns*rows may overflow
+	if columns > maxGridCells/rows {
+		return 0, 0, fmt.Errorf("grid of %dx%d cells is larger than %d cells", columns, rows, maxGridCells)
+	}
+	return columns, rows, nil
+}
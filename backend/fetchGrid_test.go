@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func TestParseGridSize(t *testing.T) {
+	// About 99x111 km around Åre
+	bounds := lib.BoundingBox{MinLongitude: 12, MinLatitude: 63, MaxLongitude: 14, MaxLatitude: 64}
+	tests := []struct {
+		name    string
+		query   string
+		columns int
+		rows    int
+		wantErr bool
+	}{
+		{name: "default cell size", query: "", columns: 40, rows: 45},
+		{name: "cell size", query: "cellSizeKm=10", columns: 10, rows: 12},
+		{name: "explicit size", query: "columns=20&rows=30", columns: 20, rows: 30},
+		{name: "largest grid", query: "columns=500&rows=500", columns: 500, rows: 500},
+		{name: "too many cells", query: "columns=501&rows=500", wantErr: true},
+		{name: "overflowing product", query: "columns=8589934592&rows=2147483648", wantErr: true},
+		{name: "huge dimension", query: "columns=9223372036854775807&rows=1", wantErr: true},
+		{name: "tiny cell size", query: "cellSizeKm=1e-300", wantErr: true},
+		{name: "zero columns", query: "columns=0", wantErr: true},
+		{name: "negative rows", query: "rows=-3", wantErr: true},
+		{name: "invalid cell size", query: "cellSizeKm=abc", wantErr: true},
+		{name: "negative cell size", query: "cellSizeKm=-1", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns, rows, err := parseGridSize(query, bounds)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %dx%d, want an error", columns, rows)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if columns != test.columns || rows != test.rows {
+				t.Errorf("got %dx%d, want %dx%d", columns, rows, test.columns, test.rows)
+			}
+		})
+	}
+}
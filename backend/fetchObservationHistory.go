@@ -0,0 +1,205 @@
+package functions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("fetchObservationHistory", FetchObservationHistory)
+}
+
+type historyPoint struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+type historyResponse struct {
+	Station    string              `json:"station"`
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	Resolution string              `json:"resolution"`
+	Points     []historyPoint      `json:"-"`
+	Buckets    []lib.HistoryBucket `json:"-"`
+	// Series is Points for raw resolution and Buckets otherwise.
+	Series interface{} `json:"points"`
+}
+
+// FetchObservationHistory returns the history of one station, e.g.
+// ?station=smhi-127310&from=2024-12-01T00:00:00Z&to=2024-12-02T00:00:00Z&resolution=hourly&format=csv
+//
+// from and to are RFC 3339 and default to the last 24 hours. resolution is raw
+// (default), hourly or daily, where hourly and daily return the min, max and
+// mean of every value. Daily buckets follow the tz parameter, default
+// Europe/Stockholm. format is json (default) or csv.
+func FetchObservationHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := r.URL.Query()
+	station := query.Get("station")
+	if station == "" {
+		http.Error(w, "station is required", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	resolution := query.Get("resolution")
+	if resolution == "" {
+		resolution = lib.ResolutionRaw
+	}
+	if resolution != lib.ResolutionRaw && resolution != lib.ResolutionHourly && resolution != lib.ResolutionDaily {
+		http.Error(w, fmt.Sprintf("unknown resolution %q", resolution), http.StatusBadRequest)
+		return
+	}
+
+	timezone := query.Get("tz")
+	if timezone == "" {
+		timezone = "Europe/Stockholm"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unknown tz %q", timezone), http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	history, err := lib.OpenObservationHistoryStore(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open history store: %v", err)
+		http.Error(w, "Failed to open history store", http.StatusInternalServerError)
+		return
+	}
+	defer history.Close()
+
+	observations, err := history.Query(r.Context(), station, from, to)
+	if err != nil {
+		log.Printf("Failed to query history of %s: %v", station, err)
+		http.Error(w, "Failed to query history", http.StatusInternalServerError)
+		return
+	}
+
+	response := historyResponse{Station: station, From: from, To: to, Resolution: resolution}
+	if resolution == lib.ResolutionRaw {
+		response.Points = make([]historyPoint, 0, len(observations))
+		for _, observation := range observations {
+			point := historyPoint{Time: observation.Timestamp(), Values: make(map[string]float64)}
+			for _, property := range lib.MeasurementProperties {
+				if value := observation.Value(property); value != nil {
+					point.Values[property] = *value
+				}
+			}
+			response.Points = append(response.Points, point)
+		}
+		response.Series = response.Points
+	} else {
+		response.Buckets, err = lib.Downsample(observations, resolution, location)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response.Series = response.Buckets
+	}
+
+	if format == "csv" {
+		writeHistoryCsv(w, response)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeHistoryCsv writes one row per point with a column per value, or per
+// aggregate of each value when downsampled.
+func writeHistoryCsv(w http.ResponseWriter, response historyResponse) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, response.Station))
+
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	formatOptional := func(value *float64) string {
+		if value == nil {
+			return ""
+		}
+		return formatFloat(*value)
+	}
+
+	writer := csv.NewWriter(w)
+	header := []string{"time"}
+	if response.Resolution == lib.ResolutionRaw {
+		header = append(header, lib.MeasurementProperties...)
+		writer.Write(header)
+		for _, point := range response.Points {
+			row := []string{point.Time.Format(time.RFC3339)}
+			for _, property := range lib.MeasurementProperties {
+				value, ok := point.Values[property]
+				if !ok {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, formatFloat(value))
+			}
+			writer.Write(row)
+		}
+	} else {
+		for _, property := range lib.MeasurementProperties {
+			header = append(header, property+"_min", property+"_max", property+"_mean")
+		}
+		writer.Write(header)
+		for _, bucket := range response.Buckets {
+			row := []string{bucket.Start.Format(time.RFC3339)}
+			for _, property := range lib.MeasurementProperties {
+				aggregate, ok := bucket.Values[property]
+				if !ok {
+					row = append(row, "", "", "")
+					continue
+				}
+				row = append(row, formatOptional(aggregate.Min), formatOptional(aggregate.Max), formatFloat(aggregate.Mean))
+			}
+			writer.Write(row)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Failed to write CSV: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+	geojson "github.com/paulmach/go.geojson"
+)
+
+func init() {
+	functions.HTTP("fetchObservations", FetchObservations)
+}
+
+// FetchObservations returns the current observations as a GeoJSON
+// FeatureCollection, e.g. ?bbox=12,62,14,64&source=smhi,skistar&has=snowDepth_cm
+//
+// Supported filters are bbox (minLon,minLat,maxLon,maxLat), source, region,
+// minElevation and maxElevation in metres, maxAge as a duration like 3h and
+// has, a list of properties that must have a value.
+func FetchObservations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	filter, err := parseObservationFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	observations, err := loadObservations(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to load observations: %v", err)
+		http.Error(w, "Failed to load observations", http.StatusInternalServerError)
+		return
+	}
+
+	collection := geojson.NewFeatureCollection()
+	for _, observation := range observations {
+		collection.AddFeature(observation.ToFeature())
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// observationCacheTTL is how long tile requests reuse the observations read
+// by an instance.
+const observationCacheTTL = 30 * time.Second
+
+var observationCache = lib.NewObservationCache(observationCacheTTL)
+
+// loadObservations returns the current observations matching the filter.
+func loadObservations(ctx context.Context, filter lib.ObservationFilter) ([]lib.Observation, error) {
+	observations, err := listObservations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Apply(observations, time.Now()), nil
+}
+
+// loadCachedObservations is loadObservations reading the store at most once
+// per observationCacheTTL, for tiles that are requested many at a time.
+func loadCachedObservations(ctx context.Context, filter lib.ObservationFilter) ([]lib.Observation, error) {
+	observations, err := observationCache.List(ctx, listObservations)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Apply(observations, time.Now()), nil
+}
+
+func listObservations(ctx context.Context) ([]lib.Observation, error) {
+	store, err := lib.OpenObservationStore(ctx, lib.LoadStoreConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return store.List(ctx)
+}
+
+func parseObservationFilter(query url.Values) (lib.ObservationFilter, error) {
+	var filter lib.ObservationFilter
+
+	if value := query.Get("bbox"); value != "" {
+		box, err := lib.ParseBoundingBox(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.BoundingBox = &box
+	}
+	filter.Sources = splitList(query.Get("source"))
+	filter.Regions = splitList(query.Get("region"))
+
+	parseElevation := func(name string) (*float64, error) {
+		value := query.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		elevation, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", name, value)
+		}
+		return &elevation, nil
+	}
+	var err error
+	if filter.MinElevation, err = parseElevation("minElevation"); err != nil {
+		return filter, err
+	}
+	if filter.MaxElevation, err = parseElevation("maxElevation"); err != nil {
+		return filter, err
+	}
+
+	if value := query.Get("maxAge"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge <= 0 {
+			return filter, fmt.Errorf("invalid maxAge %q", value)
+		}
+		filter.MaxAge = maxAge
+	}
+
+	filter.NonNull = splitList(query.Get("has"))
+	for _, property := range filter.NonNull {
+		if !slices.Contains(lib.MeasurementProperties, property) {
+			return filter, fmt.Errorf("unknown property %q", property)
+		}
+	}
+	return filter, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
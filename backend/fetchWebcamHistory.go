@@ -0,0 +1,83 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("fetchWebcamHistory", FetchWebcamHistory)
+}
+
+type webcamHistoryResponse struct {
+	Webcam string            `json:"webcam"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Frames []lib.WebcamFrame `json:"frames"`
+}
+
+// FetchWebcamHistory lists the archived frames of a webcam, oldest first, e.g.
+// ?webcam=webcam-borga&from=2024-12-01T00:00:00Z
+//
+// webcam is the id of the feature returned by fetchWebcams, with or without
+// the extension. from and to are RFC 3339 and default to the last 24 hours.
+// Older frames are thinned out to one per hour after a day and one per day
+// after a week.
+func FetchWebcamHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := r.URL.Query()
+	webcam := lib.WebcamName(query.Get("webcam"))
+	if webcam == "" {
+		http.Error(w, "webcam is required", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	store, err := lib.OpenImageStore(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open image store: %v", err)
+		http.Error(w, "Failed to open image store", http.StatusInternalServerError)
+		return
+	}
+	defer store.Close()
+
+	frames, err := lib.WebcamHistory(r.Context(), store, webcam, from, to)
+	if err != nil {
+		log.Printf("Failed to list history of %s: %v", webcam, err)
+		http.Error(w, "Failed to list webcam history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(webcamHistoryResponse{Webcam: webcam, From: from, To: to, Frames: frames})
+}
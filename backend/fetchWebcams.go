@@ -1,36 +1,21 @@
 package functions
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
-	firebase "firebase.google.com/go"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
 	geojson "github.com/paulmach/go.geojson"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 )
 
-var firebaseApp *firebase.App
-
 func init() {
-	var err error
-	ctx := context.Background()
-	conf := &firebase.Config{StorageBucket: "live-weather-eefc5.appspot.com"}
-
-	var opts []option.ClientOption
-	if _, err := os.Stat("service-account.json"); err == nil {
-		opts = append(opts, option.WithCredentialsFile("service-account.json"))
-	}
-	firebaseApp, err = firebase.NewApp(ctx, conf, opts...)
-	if err != nil {
-		log.Fatalf("error initializing Firebase app: %v", err)
-	}
-
 	functions.HTTP("fetchWebcams", FetchWebcams)
 }
 
@@ -39,42 +24,37 @@ type FileInfo struct {
 	Location geojson.Feature `json:"location"`
 }
 
+// FetchWebcams lists the latest image of every webcam as GeoJSON features with
+// their renditions, timelapse, health and visibility and sharpness scores.
 func FetchWebcams(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 
-	// Get storage client
-	client, err := firebaseApp.Storage(ctx)
+	store, err := lib.OpenImageStore(ctx, lib.LoadStoreConfig())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("error getting Firebase storage client: %v", err), http.StatusInternalServerError)
+		log.Printf("Failed to open image store: %v", err)
+		http.Error(w, "Failed to open image store", http.StatusInternalServerError)
 		return
 	}
+	defer store.Close()
 
-	// Get the default bucket
-	bucket, err := client.DefaultBucket()
+	// Only the top level, archived frames under history/ are listed by fetchWebcamHistory
+	images, err := store.List(ctx, "", false)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("error getting default Firebase storage bucket: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("error listing files: %v", err), http.StatusInternalServerError)
 		return
 	}
-
-	fmt.Println()
-
-	// List files in the bucket
-	it := bucket.Objects(ctx, nil)
 	var files []FileInfo
-
-	for {
-		objectAttrs, err := it.Next()
-		if err == iterator.Done {
-			break // No more items in the bucket
+	now := time.Now().UTC()
+	timelapses := make(map[string]string)
+
+	for _, image := range images {
+		fileName := image.Key
+		url := image.URL
+		if path.Ext(fileName) == ".gif" {
+			timelapses[lib.WebcamName(fileName)] = url
+			continue
 		}
-		if err != nil {
-			http.Error(w, fmt.Sprintf("error listing files: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		fileName := objectAttrs.Name
-		url := fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket.BucketName(), fileName)
-		location := objectAttrs.Metadata["location"]
+		location := image.Metadata["location"]
 
 		var coords []float64
 
@@ -85,12 +65,38 @@ func FetchWebcams(w http.ResponseWriter, r *http.Request) {
 
 		geojson := geojson.NewFeature(geojson.NewPointGeometry(coords))
 		geojson.SetProperty("url", url)
+		renditions := map[string]string{lib.FullRendition: url}
+		for _, rendition := range strings.Split(image.Metadata["renditions"], ",") {
+			if rendition != "" {
+				renditions[rendition] = store.URL(lib.RenditionKey(lib.WebcamName(fileName), rendition))
+			}
+		}
+		geojson.SetProperty("renditions", renditions)
+		health, reason := webcamHealthPolicy.Health(image.Metadata, now)
+		geojson.SetProperty("health", health)
+		if reason != "" {
+			geojson.SetProperty("healthReason", reason)
+		}
+		if lastChanged := image.Metadata["lastChanged"]; lastChanged != "" {
+			geojson.SetProperty("lastChanged", lastChanged)
+		}
+		for _, score := range []string{"visibility", "sharpness"} {
+			if value, err := strconv.ParseFloat(image.Metadata[score], 64); err == nil {
+				geojson.SetProperty(score, value)
+			}
+		}
 		geojson.ID = fileName
 
 		// Add file information to the list
 		files = append(files, FileInfo{URL: url, Location: *geojson})
 	}
 
+	for i := range files {
+		if timelapse, ok := timelapses[lib.WebcamName(files[i].Location.ID.(string))]; ok {
+			files[i].Location.SetProperty("timelapseUrl", timelapse)
+		}
+	}
+
 	// Set response header as JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
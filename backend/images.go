@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("images", Images)
+}
+
+// Images serves the image stored under ?key=, e.g. ?key=webcam-borga.jpg. It
+// is where the urls of the local image store point, images in Firebase
+// Storage are loaded from the bucket directly.
+func Images(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	store, err := lib.OpenImageStore(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open image store: %v", err)
+		http.Error(w, "Failed to open image store", http.StatusInternalServerError)
+		return
+	}
+	defer store.Close()
+
+	data, info, err := store.Get(r.Context(), key)
+	if errors.Is(err, lib.ErrImageNotFound) {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read image %s: %v", key, err)
+		http.Error(w, "Failed to read image", http.StatusInternalServerError)
+		return
+	}
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.CacheControl != "" {
+		w.Header().Set("Cache-Control", info.CacheControl)
+	}
+	w.Write(data)
+}
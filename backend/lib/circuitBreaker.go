@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitOpenError is returned without contacting the host while its breaker
+// is open.
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// BreakerState is the state of the breaker of one host, as shown in run reports.
+type BreakerState struct {
+	Host                string     `json:"host"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenUntil           *time.Time `json:"openUntil,omitempty"`
+}
+
+// CircuitBreakers keeps a breaker per host. After FailureThreshold failed
+// requests in a row the breaker opens and requests to the host fail fast for
+// OpenDuration. Then a single trial request decides whether it closes again.
+type CircuitBreakers struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	state               string
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+func NewCircuitBreakers(failureThreshold int, openDuration time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{FailureThreshold: failureThreshold, OpenDuration: openDuration, breakers: make(map[string]*breaker)}
+}
+
+// HostBreakers are the breakers of HTTPClient.
+var HostBreakers = NewCircuitBreakers(5, time.Minute)
+
+// allow reports whether a request to the host may be sent.
+func (b *CircuitBreakers) allow(host string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hostBreaker, ok := b.breakers[host]
+	if !ok {
+		hostBreaker = &breaker{state: BreakerClosed}
+		b.breakers[host] = hostBreaker
+	}
+	switch hostBreaker.state {
+	case BreakerOpen:
+		if now.Before(hostBreaker.openUntil) {
+			return &CircuitOpenError{Host: host, Until: hostBreaker.openUntil}
+		}
+		hostBreaker.state = BreakerHalfOpen
+		return nil
+	case BreakerHalfOpen:
+		// The trial request is still in flight
+		return &CircuitOpenError{Host: host, Until: hostBreaker.openUntil}
+	}
+	return nil
+}
+
+func (b *CircuitBreakers) record(host string, success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hostBreaker := b.breakers[host]
+	if success {
+		hostBreaker.state = BreakerClosed
+		hostBreaker.consecutiveFailures = 0
+		return
+	}
+	hostBreaker.consecutiveFailures++
+	if hostBreaker.state == BreakerHalfOpen || hostBreaker.consecutiveFailures >= b.FailureThreshold {
+		hostBreaker.state = BreakerOpen
+		hostBreaker.openUntil = now.Add(b.OpenDuration)
+	}
+}
+
+// cancel lets the next request be the trial when a trial request was cancelled.
+func (b *CircuitBreakers) cancel(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if hostBreaker := b.breakers[host]; hostBreaker.state == BreakerHalfOpen {
+		hostBreaker.state = BreakerOpen
+	}
+}
+
+// States returns the state of every host that has been contacted, sorted by host.
+func (b *CircuitBreakers) States() []BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make([]BreakerState, 0, len(b.breakers))
+	for host, hostBreaker := range b.breakers {
+		state := BreakerState{Host: host, State: hostBreaker.state, ConsecutiveFailures: hostBreaker.consecutiveFailures}
+		if hostBreaker.state != BreakerClosed {
+			openUntil := hostBreaker.openUntil
+			state.OpenUntil = &openUntil
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Host < states[j].Host
+	})
+	return states
+}
+
+type breakerTransport struct {
+	base     http.RoundTripper
+	breakers *CircuitBreakers
+}
+
+// NewBreakerTransport fails requests fast while the breaker of their host is
+// open. Network errors, 5xx and 429 responses count as failures.
+func NewBreakerTransport(base http.RoundTripper, breakers *CircuitBreakers) http.RoundTripper {
+	return &breakerTransport{base: base, breakers: breakers}
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := t.breakers.allow(host, time.Now()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	// A cancelled request says nothing about the host
+	if err != nil && req.Context().Err() != nil {
+		t.breakers.cancel(host)
+		return resp, err
+	}
+	t.breakers.record(host, !retryable(resp, err), time.Now())
+	return resp, err
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	breakers := NewCircuitBreakers(5, time.Minute)
+	const host = "opendata.smhi.se"
+
+	// Every step sends a request, records the result of the request in
+	// flight, or both
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		send     bool
+		result   string // "ok", "fail" or "" while the request is in flight
+		rejected bool
+		state    string
+	}{
+		{name: "first failure", send: true, result: "fail", state: BreakerClosed},
+		{name: "second failure", send: true, result: "fail", state: BreakerClosed},
+		{name: "success resets the count", send: true, result: "ok", state: BreakerClosed},
+		{name: "failure 1", send: true, result: "fail", state: BreakerClosed},
+		{name: "failure 2", send: true, result: "fail", state: BreakerClosed},
+		{name: "failure 3", send: true, result: "fail", state: BreakerClosed},
+		{name: "failure 4", send: true, result: "fail", state: BreakerClosed},
+		{name: "failure 5 opens", send: true, result: "fail", state: BreakerOpen},
+		{name: "fails fast while open", advance: 59 * time.Second, send: true, rejected: true, state: BreakerOpen},
+		{name: "trial after the open duration", advance: time.Second, send: true, state: BreakerHalfOpen},
+		{name: "one trial at a time", send: true, rejected: true, state: BreakerHalfOpen},
+		{name: "failed trial opens again", result: "fail", state: BreakerOpen},
+		{name: "fails fast again", advance: 30 * time.Second, send: true, rejected: true, state: BreakerOpen},
+		{name: "second trial", advance: 30 * time.Second, send: true, state: BreakerHalfOpen},
+		{name: "successful trial closes", result: "ok", state: BreakerClosed},
+		{name: "closed again", send: true, result: "fail", state: BreakerClosed},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.send {
+			err := breakers.allow(host, now)
+			var openErr *CircuitOpenError
+			if rejected := errors.As(err, &openErr); rejected != step.rejected {
+				t.Fatalf("%s: allow = %v, want rejected %v", step.name, err, step.rejected)
+			}
+		}
+		if step.result != "" {
+			breakers.record(host, step.result == "ok", now)
+		}
+		if state := breakers.States()[0].State; state != step.state {
+			t.Errorf("%s: state %s, want %s", step.name, state, step.state)
+		}
+	}
+}
+
+func TestCircuitBreakersCancelledTrial(t *testing.T) {
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	breakers := NewCircuitBreakers(1, time.Minute)
+	breakers.allow("host", now)
+	breakers.record("host", false, now)
+
+	now = now.Add(time.Minute)
+	if err := breakers.allow("host", now); err != nil {
+		t.Fatal(err)
+	}
+	breakers.cancel("host")
+	if err := breakers.allow("host", now); err != nil {
+		t.Errorf("the request after a cancelled trial is not the next trial: %v", err)
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	var requests atomic.Int32
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	breakers := NewCircuitBreakers(5, time.Minute)
+	client := &http.Client{Transport: NewBreakerTransport(http.DefaultTransport, breakers)}
+	get := func() error {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// 4xx responses are the fault of the request, not of the host
+	status = http.StatusNotFound
+	for i := 0; i < 10; i++ {
+		if err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status = http.StatusInternalServerError
+	for i := 0; i < 5; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	err := get()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("got %v, want a CircuitOpenError", err)
+	}
+	if got := requests.Load(); got != 15 {
+		t.Errorf("%d requests reached the host, want 15", got)
+	}
+	host, _ := url.Parse(server.URL)
+	states := breakers.States()
+	if len(states) != 1 || states[0].Host != host.Host || states[0].State != BreakerOpen || states[0].ConsecutiveFailures != 5 || states[0].OpenUntil == nil {
+		t.Errorf("states = %+v", states)
+	}
+}
+
+func TestBreakerTransportIgnoresCancelledRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	breakers := NewCircuitBreakers(1, time.Minute)
+	client := &http.Client{Transport: NewBreakerTransport(http.DefaultTransport, breakers)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("want the request to be cancelled")
+	}
+	if states := breakers.States(); states[0].State != BreakerClosed || states[0].ConsecutiveFailures != 0 {
+		t.Errorf("a cancelled request counted as a failure: %+v", states[0])
+	}
+}
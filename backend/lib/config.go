@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// Config describes what is fetched: the regions, webcams, ski resorts and the
+// settings of the providers. Coordinates are [longitude, latitude].
+type Config struct {
+	Regions []RegionConfig `json:"regions"`
+	// ActiveRegions are the names of the regions to fetch, all regions when
+	// empty. ACTIVE_REGIONS overrides it with a comma separated list.
+	ActiveRegions  []string              `json:"activeRegions,omitempty"`
+	Webcams        []WebcamConfig        `json:"webcams"`
+	SkistarWebcams []SkistarWebcamConfig `json:"skistarWebcams"`
+	Resorts        []ResortConfig        `json:"resorts"`
+	WebcamHealth   WebcamHealthConfig    `json:"webcamHealth"`
+	// WebcamObservations adds the visibility seen by healthy webcams as
+	// observations at the camera, see updateWebcamObservations.
+	WebcamObservations bool            `json:"webcamObservations,omitempty"`
+	Providers          ProvidersConfig `json:"providers"`
+}
+
+type RegionConfig struct {
+	Name string `json:"name"`
+	// Geometry is a GeoJSON Polygon or MultiPolygon, holes are excluded.
+	Geometry *geojson.Geometry `json:"geometry"`
+}
+
+type WebcamConfig struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Location []float64 `json:"location"`
+	ImageUrl string    `json:"imageUrl"`
+}
+
+type SkistarWebcamConfig struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Location []float64 `json:"location"`
+}
+
+// WebcamHealthConfig overrides the thresholds of DefaultWebcamHealthPolicy,
+// zero keeps the default.
+type WebcamHealthConfig struct {
+	// StaleHours is how long an image may be unchanged before the webcam is stale.
+	StaleHours float64 `json:"staleHours,omitempty"`
+	// MinBytes is the size below which an image is taken for an error placeholder.
+	MinBytes int `json:"minBytes,omitempty"`
+}
+
+// ResortConfig is a Skistar destination. Its snow page lists the areas in the
+// configured order.
+type ResortConfig struct {
+	Id      string             `json:"id"`
+	SnowUrl string             `json:"snowUrl"`
+	Areas   []ResortAreaConfig `json:"areas"`
+}
+
+type ResortAreaConfig struct {
+	Id          string `json:"id"`
+	ForecastUrl string `json:"forecastUrl"`
+	// Top and Bottom are the positions of the weather stations, Bottom is
+	// omitted for areas reporting only the top.
+	Top    []float64 `json:"top"`
+	Bottom []float64 `json:"bottom,omitempty"`
+}
+
+type ProvidersConfig struct {
+	Smhi         SmhiConfig         `json:"smhi"`
+	Trafikverket TrafikverketConfig `json:"trafikverket"`
+	Skistar      SkistarConfig      `json:"skistar"`
+}
+
+type SmhiConfig struct {
+	ApiUrl string `json:"apiUrl"`
+	// Parameters are the SMHI parameter indices to fetch.
+	Parameters []int `json:"parameters"`
+	// Workers is the number of fallback station requests in flight.
+	Workers int `json:"workers"`
+}
+
+type TrafikverketConfig struct {
+	ApiUrl string `json:"apiUrl"`
+}
+
+type SkistarConfig struct {
+	// WebcamPageUrl is followed by the webcam id.
+	WebcamPageUrl string `json:"webcamPageUrl"`
+}
+
+// LoadConfig reads the config from the file at CONFIG_PATH, the JSON in
+// CONFIG_JSON or else the embedded default, and validates it.
+func LoadConfig(embedded []byte) (*Config, error) {
+	data, origin := embedded, "embedded config"
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config: %w", err)
+		}
+		origin = path
+	} else if value := os.Getenv("CONFIG_JSON"); value != "" {
+		data, origin = []byte(value), "CONFIG_JSON"
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", origin, err)
+	}
+	if value := os.Getenv("ACTIVE_REGIONS"); value != "" {
+		config.ActiveRegions = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.ActiveRegions = append(config.ActiveRegions, name)
+			}
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s:\n%w", origin, err)
+	}
+	return &config, nil
+}
+
+// Validate returns every problem of the config, one per line.
+func (config *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(config.Regions) == 0 {
+		fail("regions: at least one region is required")
+	}
+	regionNames := make(map[string]bool)
+	for i, region := range config.Regions {
+		path := fmt.Sprintf("regions[%d]", i)
+		if region.Name == "" {
+			fail("%s.name: is required", path)
+		} else if regionNames[region.Name] {
+			fail("%s.name: duplicate region %q", path, region.Name)
+		}
+		regionNames[region.Name] = true
+		if _, err := MultiPolygonFromGeometry(region.Geometry); err != nil {
+			fail("%s.geometry: %v", path, err)
+		}
+	}
+	for i, name := range config.ActiveRegions {
+		if !regionNames[name] {
+			fail("activeRegions[%d]: unknown region %q", i, name)
+		}
+	}
+
+	webcamIds := make(map[string]bool)
+	for i, webcam := range config.Webcams {
+		path := fmt.Sprintf("webcams[%d]", i)
+		validateId(fail, path, webcam.Id, webcamIds)
+		if err := validateLocation(webcam.Location); err != nil {
+			fail("%s.location: %v", path, err)
+		}
+		if err := validateUrl(webcam.ImageUrl); err != nil {
+			fail("%s.imageUrl: %v", path, err)
+		}
+	}
+
+	skistarWebcamIds := make(map[string]bool)
+	for i, webcam := range config.SkistarWebcams {
+		path := fmt.Sprintf("skistarWebcams[%d]", i)
+		validateId(fail, path, webcam.Id, skistarWebcamIds)
+		if err := validateLocation(webcam.Location); err != nil {
+			fail("%s.location: %v", path, err)
+		}
+	}
+
+	resortIds := make(map[string]bool)
+	areaIds := make(map[string]bool)
+	for i, resort := range config.Resorts {
+		path := fmt.Sprintf("resorts[%d]", i)
+		validateId(fail, path, resort.Id, resortIds)
+		if err := validateUrl(resort.SnowUrl); err != nil {
+			fail("%s.snowUrl: %v", path, err)
+		}
+		if len(resort.Areas) == 0 {
+			fail("%s.areas: at least one area is required", path)
+		}
+		for j, area := range resort.Areas {
+			areaPath := fmt.Sprintf("%s.areas[%d]", path, j)
+			validateId(fail, areaPath, area.Id, areaIds)
+			if err := validateUrl(area.ForecastUrl); err != nil {
+				fail("%s.forecastUrl: %v", areaPath, err)
+			}
+			if err := validateLocation(area.Top); err != nil {
+				fail("%s.top: %v", areaPath, err)
+			}
+			if area.Bottom != nil {
+				if err := validateLocation(area.Bottom); err != nil {
+					fail("%s.bottom: %v", areaPath, err)
+				}
+			}
+		}
+	}
+
+	if config.WebcamHealth.StaleHours < 0 {
+		fail("webcamHealth.staleHours: must not be negative")
+	}
+	if config.WebcamHealth.MinBytes < 0 {
+		fail("webcamHealth.minBytes: must not be negative")
+	}
+
+	smhi := config.Providers.Smhi
+	if err := validateUrl(smhi.ApiUrl); err != nil {
+		fail("providers.smhi.apiUrl: %v", err)
+	}
+	if len(smhi.Parameters) == 0 {
+		fail("providers.smhi.parameters: at least one parameter is required")
+	}
+	if smhi.Workers <= 0 {
+		fail("providers.smhi.workers: must be positive")
+	}
+	if err := validateUrl(config.Providers.Trafikverket.ApiUrl); err != nil {
+		fail("providers.trafikverket.apiUrl: %v", err)
+	}
+	if len(config.SkistarWebcams) > 0 {
+		if err := validateUrl(config.Providers.Skistar.WebcamPageUrl); err != nil {
+			fail("providers.skistar.webcamPageUrl: %v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Active returns the active regions, in the order they are configured.
+func (config *Config) Active() Regions {
+	var regions Regions
+	for _, region := range config.Regions {
+		if len(config.ActiveRegions) == 0 || slices.Contains(config.ActiveRegions, region.Name) {
+			// The geometry has been validated when loading the config
+			area, _ := MultiPolygonFromGeometry(region.Geometry)
+			regions = append(regions, Region{Name: region.Name, Area: area})
+		}
+	}
+	return regions
+}
+
+// WebcamHealthPolicy is DefaultWebcamHealthPolicy with the configured overrides.
+func (config *Config) WebcamHealthPolicy() WebcamHealthPolicy {
+	policy := DefaultWebcamHealthPolicy
+	if config.WebcamHealth.StaleHours > 0 {
+		policy.StaleAfter = time.Duration(config.WebcamHealth.StaleHours * float64(time.Hour))
+	}
+	if config.WebcamHealth.MinBytes > 0 {
+		policy.MinBytes = config.WebcamHealth.MinBytes
+	}
+	return policy
+}
+
+func validateId(fail func(string, ...interface{}), path string, id string, seen map[string]bool) {
+	if id == "" {
+		fail("%s.id: is required", path)
+		return
+	}
+	if seen[id] {
+		fail("%s.id: duplicate id %q", path, id)
+	}
+	seen[id] = true
+}
+
+func validateLocation(location []float64) error {
+	if len(location) != 2 {
+		return errors.New("must be [longitude, latitude]")
+	}
+	if location[0] < -180 || location[0] > 180 || location[1] < -90 || location[1] > 90 {
+		return fmt.Errorf("[%v, %v] is not a valid [longitude, latitude]", location[0], location[1])
+	}
+	return nil
+}
+
+func validateUrl(value string) error {
+	if value == "" {
+		return errors.New("is required")
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http(s) url", value)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+func testConfig() *Config {
+	square := [][][]float64{{{12, 62}, {15, 62}, {15, 64}, {12, 64}, {12, 62}}}
+	webcams := make([]WebcamConfig, 4)
+	for i := range webcams {
+		webcams[i] = WebcamConfig{Id: string(rune('a' + i)), Location: []float64{13, 63}, ImageUrl: "https://example.com/webcam.jpg"}
+	}
+	return &Config{
+		Regions:        []RegionConfig{{Name: "jamtland", Geometry: geojson.NewPolygonGeometry(square)}},
+		Webcams:        webcams,
+		SkistarWebcams: []SkistarWebcamConfig{{Id: "are", Location: []float64{13.1, 63.4}}},
+		Resorts: []ResortConfig{{
+			Id:      "are",
+			SnowUrl: "https://example.com/snow",
+			Areas:   []ResortAreaConfig{{Id: "are-by", ForecastUrl: "https://example.com/forecast", Top: []float64{13.1, 63.4}}},
+		}},
+		Providers: ProvidersConfig{
+			Smhi:         SmhiConfig{ApiUrl: "https://example.com/smhi/", Parameters: []int{1}, Workers: 4},
+			Trafikverket: TrafikverketConfig{ApiUrl: "https://example.com/trafikverket"},
+			Skistar:      SkistarConfig{WebcamPageUrl: "https://example.com/webcam/"},
+		},
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"valid", func(*Config) {}, nil},
+		{"webcam location", func(config *Config) { config.Webcams[3].Location = []float64{13} }, []string{"webcams[3].location"}},
+		{"webcam latitude", func(config *Config) { config.Webcams[1].Location = []float64{13, 95} }, []string{"webcams[1].location"}},
+		{"webcam url", func(config *Config) { config.Webcams[0].ImageUrl = "webcam.jpg" }, []string{"webcams[0].imageUrl"}},
+		{"duplicate webcam", func(config *Config) { config.Webcams[2].Id = "a" }, []string{"webcams[2].id"}},
+		{"no regions", func(config *Config) { config.Regions = nil }, []string{"regions: "}},
+		{"region geometry", func(config *Config) { config.Regions[0].Geometry = nil }, []string{"regions[0].geometry"}},
+		{"unknown active region", func(config *Config) { config.ActiveRegions = []string{"jamtland", "skane"} }, []string{"activeRegions[1]"}},
+		{"resort area", func(config *Config) { config.Resorts[0].Areas[0].Top = nil }, []string{"resorts[0].areas[0].top"}},
+		{"negative threshold", func(config *Config) { config.WebcamHealth.MinBytes = -1 }, []string{"webcamHealth.minBytes"}},
+		{"smhi", func(config *Config) { config.Providers.Smhi.Workers = 0 }, []string{"providers.smhi.workers"}},
+		{
+			"every problem",
+			func(config *Config) {
+				config.Webcams[3].Location = nil
+				config.SkistarWebcams[0].Id = ""
+				config.Providers.Trafikverket.ApiUrl = ""
+			},
+			[]string{"webcams[3].location", "skistarWebcams[0].id", "providers.trafikverket.apiUrl"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			test.modify(config)
+			err := config.Validate()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.want) {
+				t.Errorf("got %d problems, want %d: %v", len(lines), len(test.want), err)
+			}
+			for _, path := range test.want {
+				if !strings.Contains(err.Error(), path) {
+					t.Errorf("%q is not reported in %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	embedded, err := json.Marshal(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	override := testConfig()
+	override.Webcams = override.Webcams[:1]
+	overrideJSON, err := json.Marshal(override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, overrideJSON, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := testConfig()
+	invalid.Webcams[3].Location = nil
+	invalidJSON, err := json.Marshal(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		webcams int
+		active  []string
+		wantErr string
+	}{
+		{name: "embedded", webcams: 4},
+		{name: "CONFIG_PATH", env: map[string]string{"CONFIG_PATH": path}, webcams: 1},
+		{name: "CONFIG_JSON", env: map[string]string{"CONFIG_JSON": string(overrideJSON)}, webcams: 1},
+		{name: "CONFIG_PATH before CONFIG_JSON", env: map[string]string{"CONFIG_PATH": path, "CONFIG_JSON": string(embedded)}, webcams: 1},
+		{name: "ACTIVE_REGIONS", env: map[string]string{"ACTIVE_REGIONS": " jamtland ,"}, webcams: 4, active: []string{"jamtland"}},
+		{name: "missing file", env: map[string]string{"CONFIG_PATH": filepath.Join(t.TempDir(), "missing.json")}, wantErr: "error reading config"},
+		{name: "malformed JSON", env: map[string]string{"CONFIG_JSON": "{"}, wantErr: "error parsing CONFIG_JSON"},
+		{name: "invalid override", env: map[string]string{"CONFIG_JSON": string(invalidJSON)}, wantErr: "webcams[3].location"},
+		{name: "unknown active region", env: map[string]string{"ACTIVE_REGIONS": "skane"}, wantErr: "activeRegions[0]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"CONFIG_PATH", "CONFIG_JSON", "ACTIVE_REGIONS"} {
+				t.Setenv(name, test.env[name])
+			}
+			config, err := LoadConfig(embedded)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got %v, want an error with %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(config.Webcams) != test.webcams {
+				t.Errorf("%d webcams, want %d", len(config.Webcams), test.webcams)
+			}
+			if strings.Join(config.ActiveRegions, ",") != strings.Join(test.active, ",") {
+				t.Errorf("active regions %v, want %v", config.ActiveRegions, test.active)
+			}
+		})
+	}
+}
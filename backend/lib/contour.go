@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"math"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// Contours traces the lines where the grid crosses the level using marching
+// squares over the cell centers. Squares touching a cell without an estimate
+// are skipped, so lines end at the edge of the estimated area.
+func Contours(grid *Grid, level float64) [][][]float64 {
+	var segments [][2][]float64
+	for row := 0; row < grid.Rows-1; row++ {
+		for column := 0; column < grid.Columns-1; column++ {
+			segments = append(segments, squareSegments(grid, column, row, level)...)
+		}
+	}
+	return joinSegments(segments)
+}
+
+// squareSegments returns the contour segments within the square whose corners
+// are the centers of the cells (column, row) to (column+1, row+1).
+func squareSegments(grid *Grid, column int, row int, level float64) [][2][]float64 {
+	// Corners in clockwise order starting top left
+	type corner struct {
+		column int
+		row    int
+		value  float64
+	}
+	corners := [4]corner{
+		{column, row, grid.Get(column, row)},
+		{column + 1, row, grid.Get(column+1, row)},
+		{column + 1, row + 1, grid.Get(column+1, row+1)},
+		{column, row + 1, grid.Get(column, row+1)},
+	}
+
+	index := 0
+	for i, c := range corners {
+		if math.IsNaN(c.value) {
+			return nil
+		}
+		if c.value >= level {
+			index |= 1 << i
+		}
+	}
+	if index == 0 || index == 15 {
+		return nil
+	}
+
+	// crossing interpolates where the level crosses the edge starting at corner i
+	crossing := func(edge int) []float64 {
+		a, b := corners[edge], corners[(edge+1)%4]
+		t := 0.5
+		if a.value != b.value {
+			t = (level - a.value) / (b.value - a.value)
+		}
+		aLongitude, aLatitude := grid.CellCenter(a.column, a.row)
+		bLongitude, bLatitude := grid.CellCenter(b.column, b.row)
+		return []float64{aLongitude + (bLongitude-aLongitude)*t, aLatitude + (bLatitude-aLatitude)*t}
+	}
+
+	// Edges are numbered after their first corner: 0 top, 1 right, 2 bottom, 3 left
+	var edges [][2]int
+	switch index {
+	case 1, 14:
+		edges = [][2]int{{3, 0}}
+	case 2, 13:
+		edges = [][2]int{{0, 1}}
+	case 3, 12:
+		edges = [][2]int{{3, 1}}
+	case 4, 11:
+		edges = [][2]int{{1, 2}}
+	case 6, 9:
+		edges = [][2]int{{0, 2}}
+	case 7, 8:
+		edges = [][2]int{{2, 3}}
+	case 5, 10:
+		// Saddle, decided by the average of the corners
+		center := (corners[0].value + corners[1].value + corners[2].value + corners[3].value) / 4
+		if (center >= level) == (index == 5) {
+			edges = [][2]int{{3, 2}, {0, 1}}
+		} else {
+			edges = [][2]int{{3, 0}, {1, 2}}
+		}
+	}
+
+	segments := make([][2][]float64, 0, len(edges))
+	for _, edge := range edges {
+		segments = append(segments, [2][]float64{crossing(edge[0]), crossing(edge[1])})
+	}
+	return segments
+}
+
+// joinSegments stitches segments sharing end points into lines.
+func joinSegments(segments [][2][]float64) [][][]float64 {
+	type point struct{ x, y float64 }
+	key := func(coordinate []float64) point {
+		return point{math.Round(coordinate[0]*1e9) / 1e9, math.Round(coordinate[1]*1e9) / 1e9}
+	}
+
+	used := make([]bool, len(segments))
+	byPoint := make(map[point][]int)
+	for i, segment := range segments {
+		byPoint[key(segment[0])] = append(byPoint[key(segment[0])], i)
+		byPoint[key(segment[1])] = append(byPoint[key(segment[1])], i)
+	}
+
+	// next finds an unused segment touching the coordinate and returns its other end
+	next := func(coordinate []float64) ([]float64, bool) {
+		for _, i := range byPoint[key(coordinate)] {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			if key(segments[i][0]) == key(coordinate) {
+				return segments[i][1], true
+			}
+			return segments[i][0], true
+		}
+		return nil, false
+	}
+
+	var lines [][][]float64
+	for i, segment := range segments {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		line := [][]float64{segment[0], segment[1]}
+		for coordinate, ok := next(line[len(line)-1]); ok; coordinate, ok = next(line[len(line)-1]) {
+			line = append(line, coordinate)
+		}
+		var head [][]float64
+		for coordinate, ok := next(line[0]); ok; coordinate, ok = next(head[len(head)-1]) {
+			head = append(head, coordinate)
+		}
+		for j := len(head) - 1; j >= 0; j-- {
+			line = append([][]float64{head[j]}, line...)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ContourFeatureCollection returns a LineString feature per contour line of
+// every level, with the property name and the level as properties.
+func ContourFeatureCollection(grid *Grid, property string, levels []float64) *geojson.FeatureCollection {
+	collection := geojson.NewFeatureCollection()
+	for _, level := range levels {
+		for _, line := range Contours(grid, level) {
+			feature := geojson.NewLineStringFeature(line)
+			feature.SetProperty("property", property)
+			feature.SetProperty("level", level)
+			collection.AddFeature(feature)
+		}
+	}
+	return collection
+}
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	geojson "github.com/paulmach/go.geojson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrContoursNotFound is returned when no contours have been published under a name.
+var ErrContoursNotFound = errors.New("contours not found")
+
+// ContourStore keeps the latest published contour lines by name, e.g. "temperature_c".
+type ContourStore interface {
+	PutContours(ctx context.Context, name string, collection *geojson.FeatureCollection) error
+	GetContours(ctx context.Context, name string) (*geojson.FeatureCollection, error)
+	Close() error
+}
+
+const contourCollection = "weatherContours"
+
+var sharedMemoryContourStore = NewMemoryContourStore()
+
+func OpenContourStore(ctx context.Context, config StoreConfig) (ContourStore, error) {
+	switch config.Backend {
+	case StoreBackendFirestore:
+		return NewFirestoreContourStore(ctx)
+	case StoreBackendMemory:
+		return sharedMemoryContourStore, nil
+	case StoreBackendFile:
+		return NewFileContourStore(filepath.Join(config.Dir, "contours")), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+	}
+}
+
+// FirestoreContourStore keeps one document per name in weatherContours. The
+// FeatureCollection is stored as a JSON string since Firestore does not
+// support the nested arrays of LineString coordinates.
+type FirestoreContourStore struct {
+	client *firestore.Client
+	// ownsClient is false when the client is shared with other stores
+	ownsClient bool
+}
+
+func NewFirestoreContourStore(ctx context.Context) (*FirestoreContourStore, error) {
+	client, err := NewFirestoreClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreContourStore{client: client, ownsClient: true}, nil
+}
+
+// NewSharedFirestoreContourStore uses a client that the caller closes.
+func NewSharedFirestoreContourStore(client *firestore.Client) *FirestoreContourStore {
+	return &FirestoreContourStore{client: client}
+}
+
+func (s *FirestoreContourStore) PutContours(ctx context.Context, name string, collection *geojson.FeatureCollection) error {
+	data, err := collection.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal contours: %w", err)
+	}
+	_, err = s.client.Collection(contourCollection).Doc(name).Set(ctx, map[string]interface{}{
+		"geojson":   string(data),
+		"updatedAt": time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store contours %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *FirestoreContourStore) GetContours(ctx context.Context, name string) (*geojson.FeatureCollection, error) {
+	doc, err := s.client.Collection(contourCollection).Doc(name).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrContoursNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contours %s: %w", name, err)
+	}
+	data, ok := doc.Data()["geojson"].(string)
+	if !ok {
+		return nil, fmt.Errorf("contours %s have no geojson", name)
+	}
+	return geojson.UnmarshalFeatureCollection([]byte(data))
+}
+
+func (s *FirestoreContourStore) Close() error {
+	if !s.ownsClient {
+		return nil
+	}
+	return s.client.Close()
+}
+
+type MemoryContourStore struct {
+	mu       sync.RWMutex
+	contours map[string]*geojson.FeatureCollection
+}
+
+func NewMemoryContourStore() *MemoryContourStore {
+	return &MemoryContourStore{contours: make(map[string]*geojson.FeatureCollection)}
+}
+
+func (s *MemoryContourStore) PutContours(ctx context.Context, name string, collection *geojson.FeatureCollection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.contours[name] = collection
+	return nil
+}
+
+func (s *MemoryContourStore) GetContours(ctx context.Context, name string) (*geojson.FeatureCollection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collection, ok := s.contours[name]
+	if !ok {
+		return nil, ErrContoursNotFound
+	}
+	return collection, nil
+}
+
+func (s *MemoryContourStore) Close() error {
+	return nil
+}
+
+// FileContourStore writes one GeoJSON file per name.
+type FileContourStore struct {
+	dir string
+}
+
+func NewFileContourStore(dir string) *FileContourStore {
+	return &FileContourStore{dir: dir}
+}
+
+func (s *FileContourStore) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+".geojson")
+}
+
+func (s *FileContourStore) PutContours(ctx context.Context, name string, collection *geojson.FeatureCollection) error {
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contours: %w", err)
+	}
+	return writeFileAtomic(s.path(name), data)
+}
+
+func (s *FileContourStore) GetContours(ctx context.Context, name string) (*geojson.FeatureCollection, error) {
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrContoursNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contours %s: %w", name, err)
+	}
+	return geojson.UnmarshalFeatureCollection(data)
+}
+
+func (s *FileContourStore) Close() error {
+	return nil
+}
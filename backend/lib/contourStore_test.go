@@ -0,0 +1,38 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+func TestContourStoreContract(t *testing.T) {
+	ctx := context.Background()
+	for backend, stores := range testBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			store := stores.Contours
+			if _, err := store.GetContours(ctx, "temperature_c"); !errors.Is(err, ErrContoursNotFound) {
+				t.Fatalf("got %v, want ErrContoursNotFound", err)
+			}
+
+			for _, features := range []int{2, 1} {
+				collection := geojson.NewFeatureCollection()
+				for i := 0; i < features; i++ {
+					collection.AddFeature(geojson.NewLineStringFeature([][]float64{{12, 63}, {13, 64}}))
+				}
+				if err := store.PutContours(ctx, "temperature_c", collection); err != nil {
+					t.Fatal(err)
+				}
+			}
+			collection, err := store.GetContours(ctx, "temperature_c")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(collection.Features) != 1 {
+				t.Errorf("got %d features, want the 1 of the last put", len(collection.Features))
+			}
+		})
+	}
+}
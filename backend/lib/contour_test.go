@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+// squareGrid is a 2x2 grid over [0, 2]x[0, 2], so the cell centers are at
+// 0.5 and 1.5 and the edge midpoints of the square between them at 1.
+func squareGrid(topLeft, topRight, bottomRight, bottomLeft float64) *Grid {
+	grid := NewGrid(BoundingBox{MinLongitude: 0, MinLatitude: 0, MaxLongitude: 2, MaxLatitude: 2}, 2, 2)
+	grid.Set(0, 0, topLeft)
+	grid.Set(1, 0, topRight)
+	grid.Set(1, 1, bottomRight)
+	grid.Set(0, 1, bottomLeft)
+	return grid
+}
+
+// segmentKeys describes two point lines independent of their direction and order.
+func segmentKeys(lines [][][]float64) []string {
+	var keys []string
+	for _, line := range lines {
+		var points []string
+		for _, coordinate := range line {
+			points = append(points, fmt.Sprintf("(%.3f %.3f)", coordinate[0], coordinate[1]))
+		}
+		if len(points) == 2 && points[1] < points[0] {
+			points[0], points[1] = points[1], points[0]
+		}
+		keys = append(keys, fmt.Sprint(points))
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestContoursSquare(t *testing.T) {
+	const (
+		top    = "(1.000 1.500)"
+		right  = "(1.500 1.000)"
+		bottom = "(1.000 0.500)"
+		left   = "(0.500 1.000)"
+	)
+	segment := func(a, b string) string {
+		if b < a {
+			a, b = b, a
+		}
+		return fmt.Sprint([]string{a, b})
+	}
+	tests := []struct {
+		name  string
+		grid  *Grid
+		level float64
+		want  []string
+	}{
+		{"all below", squareGrid(0, 0, 0, 0), 0.5, nil},
+		{"all above", squareGrid(1, 1, 1, 1), 0.5, nil},
+		{"missing corner", squareGrid(1, 0, 0, math.NaN()), 0.5, nil},
+		{"top left corner", squareGrid(1, 0, 0, 0), 0.5, []string{segment(left, top)}},
+		{"bottom right corner", squareGrid(1, 1, 0, 1), 0.5, []string{segment(right, bottom)}},
+		{"interpolated crossing", squareGrid(1, 0, 0, 0), 0.25, []string{segment("(0.500 0.750)", "(1.250 1.500)")}},
+		{"vertical line", squareGrid(1, 0, 0, 1), 0.5, []string{segment(top, bottom)}},
+		{"horizontal line", squareGrid(0, 0, 1, 1), 0.5, []string{segment(left, right)}},
+		// In saddles the center decides whether the high corners are
+		// connected. At level 0.4 the crossings are 0.6 from the high
+		// corners, at 0.6 they are 0.4 from them.
+		{"saddle 5 with high center", squareGrid(1, 0, 1, 0), 0.4, []string{
+			segment("(0.500 0.900)", "(0.900 0.500)"), segment("(1.100 1.500)", "(1.500 1.100)"),
+		}},
+		{"saddle 5 with low center", squareGrid(1, 0, 1, 0), 0.6, []string{
+			segment("(0.500 1.100)", "(0.900 1.500)"), segment("(1.100 0.500)", "(1.500 0.900)"),
+		}},
+		{"saddle 10 with high center", squareGrid(0, 1, 0, 1), 0.4, []string{
+			segment("(0.500 1.100)", "(0.900 1.500)"), segment("(1.100 0.500)", "(1.500 0.900)"),
+		}},
+		{"saddle 10 with low center", squareGrid(0, 1, 0, 1), 0.6, []string{
+			segment("(0.500 0.900)", "(0.900 0.500)"), segment("(1.100 1.500)", "(1.500 1.100)"),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := slices.Clone(test.want)
+			slices.Sort(want)
+			if got := segmentKeys(Contours(test.grid, test.level)); !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestContoursJoinsSegments(t *testing.T) {
+	// A peak in the middle of a 3x3 grid is circled by one closed line
+	grid := NewGrid(BoundingBox{MinLongitude: 0, MinLatitude: 0, MaxLongitude: 3, MaxLatitude: 3}, 3, 3)
+	for i := range grid.Values {
+		grid.Values[i] = 0
+	}
+	grid.Set(1, 1, 1)
+
+	lines := Contours(grid, 0.5)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if len(line) != 5 {
+		t.Fatalf("got %d coordinates, want 5", len(line))
+	}
+	if !slices.Equal(line[0], line[len(line)-1]) {
+		t.Errorf("line is not closed: %v", line)
+	}
+	for _, coordinate := range line {
+		if distance := math.Hypot(coordinate[0]-1.5, coordinate[1]-1.5); math.Abs(distance-0.5) > 1e-9 {
+			t.Errorf("%v is %f from the peak, want 0.5", coordinate, distance)
+		}
+	}
+}
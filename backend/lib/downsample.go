@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	ResolutionRaw    = "raw"
+	ResolutionHourly = "hourly"
+	ResolutionDaily  = "daily"
+)
+
+// Aggregate summarizes the values of a property in a bucket. Min and Max are
+// left out for circular properties, see circularProperties.
+type Aggregate struct {
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Mean  float64  `json:"mean"`
+	Count int      `json:"count"`
+}
+
+// circularProperties are angles in degrees, averaged as vectors so that 350°
+// and 10° give 0° rather than 180°.
+var circularProperties = map[string]bool{
+	"windDirection_deg": true,
+}
+
+// vectorSum adds up unit vectors of angles, weighted and unweighted.
+type vectorSum struct {
+	sin, cos                 float64
+	weightedSin, weightedCos float64
+}
+
+func (sum *vectorSum) add(degrees float64, weight float64) {
+	radians := degrees * math.Pi / 180
+	sum.sin += math.Sin(radians)
+	sum.cos += math.Cos(radians)
+	sum.weightedSin += weight * math.Sin(radians)
+	sum.weightedCos += weight * math.Cos(radians)
+}
+
+// mean is the direction of the weighted sum in [0, 360), or of the unweighted
+// sum when all weights are zero, e.g. in calm wind.
+func (sum vectorSum) mean() float64 {
+	sin, cos := sum.weightedSin, sum.weightedCos
+	if sin == 0 && cos == 0 {
+		sin, cos = sum.sin, sum.cos
+	}
+	// Mod also maps a tiny negative angle, which rounds to 360, back to 0
+	return math.Mod(math.Atan2(sin, cos)*180/math.Pi+360, 360)
+}
+
+// HistoryBucket summarizes the observations starting at Start and ending
+// before the next bucket.
+type HistoryBucket struct {
+	Start  time.Time            `json:"time"`
+	Values map[string]Aggregate `json:"values"`
+}
+
+// Downsample groups the observations into hourly or daily buckets, aligned to
+// the location, and aggregates every measured value within each bucket. Wind
+// directions are averaged as vectors weighted by the wind speed, when reported.
+func Downsample(observations []Observation, resolution string, location *time.Location) ([]HistoryBucket, error) {
+	var bucketStart func(time.Time) time.Time
+	switch resolution {
+	case ResolutionHourly:
+		bucketStart = func(t time.Time) time.Time {
+			t = t.In(location)
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location)
+		}
+	case ResolutionDaily:
+		bucketStart = func(t time.Time) time.Time {
+			t = t.In(location)
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+		}
+	default:
+		return nil, fmt.Errorf("unknown resolution %q", resolution)
+	}
+
+	sums := make(map[time.Time]map[string]float64)
+	vectors := make(map[time.Time]map[string]*vectorSum)
+	buckets := make(map[time.Time]*HistoryBucket)
+	for _, observation := range observations {
+		start := bucketStart(observation.Timestamp())
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = &HistoryBucket{Start: start, Values: make(map[string]Aggregate)}
+			buckets[start] = bucket
+			sums[start] = make(map[string]float64)
+			vectors[start] = make(map[string]*vectorSum)
+		}
+
+		for _, property := range MeasurementProperties {
+			value := observation.Value(property)
+			if value == nil {
+				continue
+			}
+			aggregate := bucket.Values[property]
+			aggregate.Count++
+			if circularProperties[property] {
+				weight := 1.0
+				if observation.WindSpeedMs != nil {
+					weight = *observation.WindSpeedMs
+				}
+				if vectors[start][property] == nil {
+					vectors[start][property] = &vectorSum{}
+				}
+				vectors[start][property].add(*value, weight)
+				bucket.Values[property] = aggregate
+				continue
+			}
+			if aggregate.Min == nil {
+				aggregate.Min, aggregate.Max = new(float64), new(float64)
+				*aggregate.Min, *aggregate.Max = *value, *value
+			}
+			*aggregate.Min = min(*aggregate.Min, *value)
+			*aggregate.Max = max(*aggregate.Max, *value)
+			sums[start][property] += *value
+			bucket.Values[property] = aggregate
+		}
+	}
+
+	result := make([]HistoryBucket, 0, len(buckets))
+	for start, bucket := range buckets {
+		for property, aggregate := range bucket.Values {
+			if vector, ok := vectors[start][property]; ok {
+				aggregate.Mean = vector.mean()
+			} else {
+				aggregate.Mean = sums[start][property] / float64(aggregate.Count)
+			}
+			bucket.Values[property] = aggregate
+		}
+		result = append(result, *bucket)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func windObservation(t time.Time, direction float64, speed *float64) Observation {
+	return Observation{ObservedAt: &t, WindDirectionDeg: &direction, WindSpeedMs: speed}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+// angleDiff is the smallest difference between two directions in degrees.
+func angleDiff(a float64, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), 360)
+	return math.Min(diff, 360-diff)
+}
+
+func TestDownsampleWindDirection(t *testing.T) {
+	start := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		directions []float64
+		speeds     []*float64
+		want       float64
+	}{
+		{"wraps around north", []float64{350, 10}, []*float64{nil, nil}, 0},
+		{"wraps with 360", []float64{360, 20}, []*float64{nil, nil}, 10},
+		{"east", []float64{80, 100}, []*float64{nil, nil}, 90},
+		{"weighted by speed", []float64{0, 90}, []*float64{floatPtr(1), floatPtr(3)}, math.Atan2(3, 1) * 180 / math.Pi},
+		{"calm falls back to unweighted", []float64{350, 30}, []*float64{floatPtr(0), floatPtr(0)}, 10},
+		{"west of north", []float64{300, 340}, []*float64{nil, nil}, 320},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var observations []Observation
+			for i, direction := range test.directions {
+				observations = append(observations, windObservation(start.Add(time.Duration(i)*time.Minute), direction, test.speeds[i]))
+			}
+			buckets, err := Downsample(observations, ResolutionHourly, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buckets) != 1 {
+				t.Fatalf("got %d buckets, want 1", len(buckets))
+			}
+			aggregate := buckets[0].Values["windDirection_deg"]
+			if angleDiff(aggregate.Mean, test.want) > 1e-6 {
+				t.Errorf("mean = %f, want %f", aggregate.Mean, test.want)
+			}
+			if aggregate.Mean < 0 || aggregate.Mean >= 360 {
+				t.Errorf("mean %f is outside [0, 360)", aggregate.Mean)
+			}
+			if aggregate.Min != nil || aggregate.Max != nil {
+				t.Errorf("min and max should be left out for directions")
+			}
+			if aggregate.Count != len(test.directions) {
+				t.Errorf("count = %d, want %d", aggregate.Count, len(test.directions))
+			}
+		})
+	}
+}
+
+func TestDownsampleLinearProperties(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Skip(err)
+	}
+	temperature := func(t time.Time, value float64) Observation {
+		return Observation{ObservedAt: &t, TemperatureC: &value}
+	}
+	// 22:30 and 23:30 UTC are on different days in Stockholm
+	observations := []Observation{
+		temperature(time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC), -4),
+		temperature(time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC), 2),
+		temperature(time.Date(2024, 12, 1, 22, 30, 0, 0, time.UTC), -1),
+		temperature(time.Date(2024, 12, 1, 23, 30, 0, 0, time.UTC), -9),
+	}
+	buckets, err := Downsample(observations, ResolutionDaily, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	first := buckets[0].Values["temperature_c"]
+	if *first.Min != -4 || *first.Max != 2 || math.Abs(first.Mean-(-1)) > 1e-9 || first.Count != 3 {
+		t.Errorf("first day = min %v max %v mean %v count %d", *first.Min, *first.Max, first.Mean, first.Count)
+	}
+	if second := buckets[1].Values["temperature_c"]; second.Mean != -9 || second.Count != 1 {
+		t.Errorf("second day = mean %v count %d", second.Mean, second.Count)
+	}
+
+	if _, err := Downsample(observations, "weekly", location); err == nil {
+		t.Error("expected an error for an unknown resolution")
+	}
+}
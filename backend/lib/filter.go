@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// ParseBoundingBox parses "minLon,minLat,maxLon,maxLat".
+func ParseBoundingBox(value string) (BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat, got %q", value)
+	}
+	var coordinates [4]float64
+	for i, part := range parts {
+		coordinate, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, fmt.Errorf("invalid bbox coordinate %q: %w", part, err)
+		}
+		coordinates[i] = coordinate
+	}
+	box := BoundingBox{MinLongitude: coordinates[0], MinLatitude: coordinates[1], MaxLongitude: coordinates[2], MaxLatitude: coordinates[3]}
+	if box.MinLongitude > box.MaxLongitude || box.MinLatitude > box.MaxLatitude {
+		return BoundingBox{}, fmt.Errorf("bbox minimum is larger than maximum in %q", value)
+	}
+	return box, nil
+}
+
+func (box BoundingBox) Contains(longitude float64, latitude float64) bool {
+	return longitude >= box.MinLongitude &&
+		longitude <= box.MaxLongitude &&
+		latitude >= box.MinLatitude &&
+		latitude <= box.MaxLatitude
+}
+
+// ObservationFilter selects observations, zero valued fields match everything.
+type ObservationFilter struct {
+	BoundingBox *BoundingBox
+	// Sources the observation must come from, e.g. "smhi".
+	Sources []string
+	// Regions the observation must be in, e.g. "jamtland".
+	Regions      []string
+	MinElevation *float64
+	MaxElevation *float64
+	// MaxAge drops observations older than this, observations without a
+	// timestamp are considered stale.
+	MaxAge time.Duration
+	// Properties that must have a value, e.g. "snowDepth_cm".
+	NonNull []string
+}
+
+func (filter ObservationFilter) Matches(observation Observation, now time.Time) bool {
+	if filter.BoundingBox != nil && !filter.BoundingBox.Contains(*observation.Longitude, *observation.Latitude) {
+		return false
+	}
+	if len(filter.Sources) > 0 {
+		if observation.Source == nil || !slices.Contains(filter.Sources, *observation.Source) {
+			return false
+		}
+	}
+	if len(filter.Regions) > 0 {
+		if observation.Region == nil || !slices.Contains(filter.Regions, *observation.Region) {
+			return false
+		}
+	}
+	if filter.MinElevation != nil && (observation.Elevation == nil || *observation.Elevation < *filter.MinElevation) {
+		return false
+	}
+	if filter.MaxElevation != nil && (observation.Elevation == nil || *observation.Elevation > *filter.MaxElevation) {
+		return false
+	}
+	if filter.MaxAge > 0 {
+		timestamp := observation.Timestamp()
+		if timestamp.IsZero() || now.Sub(timestamp) > filter.MaxAge {
+			return false
+		}
+	}
+	for _, property := range filter.NonNull {
+		if observation.Value(property) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (filter ObservationFilter) Apply(observations []Observation, now time.Time) []Observation {
+	var filtered []Observation
+	for _, observation := range observations {
+		if filter.Matches(observation, now) {
+			filtered = append(filtered, observation)
+		}
+	}
+	return filtered
+}
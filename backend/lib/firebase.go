@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	firebase "firebase.google.com/go"
+	"google.golang.org/api/option"
+)
+
+const (
+	defaultFirebaseProjectID = "live-weather-eefc5"
+)
+
+var (
+	firebaseAppMu sync.Mutex
+	firebaseApp   *firebase.App
+)
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// FirebaseProjectID is read from FIREBASE_PROJECT_ID and defaults to the
+// production project.
+func FirebaseProjectID() string {
+	return envOrDefault("FIREBASE_PROJECT_ID", defaultFirebaseProjectID)
+}
+
+// FirebaseApp returns the process wide Firebase app, initializing it on first
+// use. Credentials are read from service-account.json when present.
+func FirebaseApp(ctx context.Context) (*firebase.App, error) {
+	firebaseAppMu.Lock()
+	defer firebaseAppMu.Unlock()
+
+	if firebaseApp != nil {
+		return firebaseApp, nil
+	}
+
+	var opts []option.ClientOption
+	if _, err := os.Stat("service-account.json"); err == nil {
+		opts = append(opts, option.WithCredentialsFile("service-account.json"))
+	}
+	projectID := FirebaseProjectID()
+	conf := &firebase.Config{
+		ProjectID:     projectID,
+		DatabaseURL:   envOrDefault("FIREBASE_DATABASE_URL", fmt.Sprintf("https://%s.firebaseio.com", projectID)),
+		StorageBucket: envOrDefault("FIREBASE_STORAGE_BUCKET", fmt.Sprintf("%s.appspot.com", projectID)),
+	}
+	app, err := firebase.NewApp(ctx, conf, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firebase app: %w", err)
+	}
+	firebaseApp = app
+	return firebaseApp, nil
+}
+
+// NewFirestoreClient creates a Firestore client of the Firebase app. The
+// caller closes it.
+func NewFirestoreClient(ctx context.Context) (*firestore.Client, error) {
+	app, err := FirebaseApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore client: %w", err)
+	}
+	return client, nil
+}
@@ -2,96 +2,78 @@ package lib
 
 import (
 	"context"
-	"encoding/json"
-	"log"
-	"os"
+	"fmt"
 
-	firebase "firebase.google.com/go"
-	geojson "github.com/paulmach/go.geojson"
-	"google.golang.org/api/option"
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
 )
 
-type Observation struct {
-	Id               *string  `json:"id"`
-	Name             *string  `json:"name"`
-	Latitude         *float64 `json:"latitude"`
-	Longitude        *float64 `json:"longitude"`
-	Elevation        *float64 `json:"elevation"`
-	TemperatureC     *float64 `json:"temperature_c"`
-	WindSpeedMs      *float64 `json:"windSpeed_ms"`
-	WindDirectionDeg *float64 `json:"windDirection_deg"`
-	WindGustSpeedMs  *float64 `json:"windGustSpeed_ms"`
-	HumidityPercent  *float64 `json:"humidity_percent"`
-	NewSnow24hCm     *float64 `json:"newSnow24h_cm"`
-	NewSnow72hCm     *float64 `json:"newSnow72h_cm"`
-	SnowDepthCm      *float64 `json:"snowDepth_cm"`
-	VisibilityM      *float64 `json:"visibility_m"`
+const defaultObservationCollection = "weatherObservations"
+
+// FirestoreObservationStore keeps one GeoJSON feature document per station.
+// Documents are written with schemaVersion ObservationSchemaVersion.
+type FirestoreObservationStore struct {
+	client     *firestore.Client
+	collection string
+	// ownsClient is false when the client is shared with other stores
+	ownsClient bool
 }
 
-func UploadObservationsToFirestore(observations []Observation) error {
-	ctx := context.Background()
-	var opts []option.ClientOption
-	if _, err := os.Stat("service-account.json"); err == nil {
-		opts = append(opts, option.WithCredentialsFile("service-account.json"))
-	}
-	conf := &firebase.Config{
-		DatabaseURL: "https://live-weather-eefc5.firebaseio.com",
-	}
-	app, err := firebase.NewApp(ctx, conf, opts...)
+func NewFirestoreObservationStore(ctx context.Context, collection string) (*FirestoreObservationStore, error) {
+	client, err := NewFirestoreClient(ctx)
 	if err != nil {
-		log.Fatalf("error initializing app: %v", err)
+		return nil, err
 	}
+	return &FirestoreObservationStore{client: client, collection: collection, ownsClient: true}, nil
+}
 
-	firestoreClient, err := app.Firestore(ctx)
-	if err != nil {
-		log.Fatalf("error initializing Firestore client: %v", err)
-	}
-	defer firestoreClient.Close()
+// NewSharedFirestoreObservationStore uses a client that the caller closes.
+func NewSharedFirestoreObservationStore(client *firestore.Client, collection string) *FirestoreObservationStore {
+	return &FirestoreObservationStore{client: client, collection: collection}
+}
 
-	var features []geojson.Feature
+func (s *FirestoreObservationStore) Put(ctx context.Context, observations []Observation) error {
 	for _, observation := range observations {
-		feature := geojson.NewPointFeature([]float64{*observation.Longitude, *observation.Latitude})
-		feature.ID = *observation.Id
-		feature.Properties = map[string]interface{}{
-			"name":              observation.Name,
-			"elevation":         observation.Elevation,
-			"temperature_c":     observation.TemperatureC,
-			"windSpeed_ms":      observation.WindSpeedMs,
-			"windDirection_deg": observation.WindDirectionDeg,
-			"windGustSpeed_ms":  observation.WindGustSpeedMs,
-			"humidity_percent":  observation.HumidityPercent,
-			"newSnow24h_cm":     observation.NewSnow24hCm,
-			"newSnow72h_cm":     observation.NewSnow72hCm,
-			"snowDepth_cm":      observation.SnowDepthCm,
-			"visibility_m":      observation.VisibilityM,
+		geoJsonMap, err := observation.ToMap()
+		if err != nil {
+			return err
 		}
-		features = append(features, *feature)
-	}
 
-	for _, feature := range features {
-		id, ok := feature.ID.(string)
-		if !ok {
-			log.Fatal("feature.ID is not a string")
+		// Replace the document like the other backends, so a value the station
+		// stopped reporting is not kept next to a fresh observedAt. The history
+		// subcollection is not affected.
+		if _, err := s.client.Collection(s.collection).Doc(*observation.Id).Set(ctx, geoJsonMap); err != nil {
+			return fmt.Errorf("failed to store document %s: %w", *observation.Id, err)
 		}
+	}
+	return nil
+}
 
-		geoJsonBytes, marshalErr := feature.MarshalJSON()
-		if marshalErr != nil {
-			log.Printf("Failed to marshal feature: %v", marshalErr)
-			return marshalErr
+func (s *FirestoreObservationStore) List(ctx context.Context) ([]Observation, error) {
+	var observations []Observation
+	it := s.client.Collection(s.collection).Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
 		}
-
-		var geoJsonMap map[string]interface{}
-		unmarshalErr := json.Unmarshal(geoJsonBytes, &geoJsonMap)
-		if unmarshalErr != nil {
-			log.Printf("Failed to unmarshal JSON into map: %v", unmarshalErr)
-			return unmarshalErr
+		if err != nil {
+			return nil, fmt.Errorf("error listing documents: %w", err)
 		}
 
-		_, err := firestoreClient.Collection("weatherObservations").Doc(id).Set(ctx, geoJsonMap)
+		observation, err := ObservationFromMap(doc.Data())
 		if err != nil {
-			log.Printf("Failed to store document: %v", err)
-			return err
+			return nil, fmt.Errorf("error reading document %s: %w", doc.Ref.ID, err)
 		}
+		observations = append(observations, observation)
 	}
-	return nil
+	return observations, nil
+}
+
+func (s *FirestoreObservationStore) Close() error {
+	if !s.ownsClient {
+		return nil
+	}
+	return s.client.Close()
 }
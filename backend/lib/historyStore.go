@@ -0,0 +1,345 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	geojson "github.com/paulmach/go.geojson"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ObservationHistoryStore keeps every ingested observation as a time series per
+// station. Points are keyed by the observation time, so appending the same
+// observation twice only stores it once. Observations without an observation
+// time are not appended, as every run would add another point for them.
+type ObservationHistoryStore interface {
+	// Append stores the observations and returns how many of them were new.
+	Append(ctx context.Context, observations []Observation) (int, error)
+	// Query returns the observations of the station within [from, to], oldest first.
+	Query(ctx context.Context, stationId string, from time.Time, to time.Time) ([]Observation, error)
+	Close() error
+}
+
+const historyCollection = "history"
+
+// Timestamp is the source's observation time, or the fetch time when the
+// source has none. The history only stores observations with an observation
+// time, so its points are always keyed by that; the fetch time is used by the
+// maxAge filter of the current observations.
+func (observation Observation) Timestamp() time.Time {
+	if observation.ObservedAt != nil {
+		return observation.ObservedAt.UTC()
+	}
+	if observation.FetchedAt != nil {
+		return observation.FetchedAt.UTC()
+	}
+	return time.Time{}
+}
+
+func historyKey(timestamp time.Time) string {
+	return timestamp.UTC().Format("20060102T150405Z")
+}
+
+var sharedMemoryHistoryStore = NewMemoryHistoryStore()
+
+func OpenObservationHistoryStore(ctx context.Context, config StoreConfig) (ObservationHistoryStore, error) {
+	switch config.Backend {
+	case StoreBackendFirestore:
+		return NewFirestoreHistoryStore(ctx, config.Collection)
+	case StoreBackendMemory:
+		return sharedMemoryHistoryStore, nil
+	case StoreBackendFile:
+		return NewFileHistoryStore(filepath.Join(config.Dir, "history")), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+	}
+}
+
+// FirestoreHistoryStore writes the points to a history subcollection below
+// each station document, e.g. weatherObservations/smhi-1234/history/20241201T120000Z.
+type FirestoreHistoryStore struct {
+	client     *firestore.Client
+	collection string
+	// ownsClient is false when the client is shared with other stores
+	ownsClient bool
+}
+
+func NewFirestoreHistoryStore(ctx context.Context, collection string) (*FirestoreHistoryStore, error) {
+	client, err := NewFirestoreClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreHistoryStore{client: client, collection: collection, ownsClient: true}, nil
+}
+
+// NewSharedFirestoreHistoryStore uses a client that the caller closes.
+func NewSharedFirestoreHistoryStore(client *firestore.Client, collection string) *FirestoreHistoryStore {
+	return &FirestoreHistoryStore{client: client, collection: collection}
+}
+
+func (s *FirestoreHistoryStore) history(stationId string) *firestore.CollectionRef {
+	return s.client.Collection(s.collection).Doc(stationId).Collection(historyCollection)
+}
+
+func (s *FirestoreHistoryStore) Append(ctx context.Context, observations []Observation) (int, error) {
+	appended := 0
+	for _, observation := range observations {
+		if observation.ObservedAt == nil {
+			continue
+		}
+		timestamp := observation.Timestamp()
+
+		geoJsonMap, err := observation.ToMap()
+		if err != nil {
+			return appended, err
+		}
+		geoJsonMap["timestamp"] = timestamp
+
+		_, err = s.history(*observation.Id).Doc(historyKey(timestamp)).Create(ctx, geoJsonMap)
+		if status.Code(err) == codes.AlreadyExists {
+			continue
+		}
+		if err != nil {
+			return appended, fmt.Errorf("failed to store history of %s: %w", *observation.Id, err)
+		}
+		appended++
+	}
+	return appended, nil
+}
+
+func (s *FirestoreHistoryStore) Query(ctx context.Context, stationId string, from time.Time, to time.Time) ([]Observation, error) {
+	it := s.history(stationId).
+		Where("timestamp", ">=", from).
+		Where("timestamp", "<=", to).
+		OrderBy("timestamp", firestore.Asc).
+		Documents(ctx)
+	defer it.Stop()
+
+	var observations []Observation
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error querying history of %s: %w", stationId, err)
+		}
+
+		data := doc.Data()
+		delete(data, "timestamp")
+		observation, err := ObservationFromMap(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history document %s: %w", doc.Ref.Path, err)
+		}
+		observations = append(observations, observation)
+	}
+	return observations, nil
+}
+
+func (s *FirestoreHistoryStore) Close() error {
+	if !s.ownsClient {
+		return nil
+	}
+	return s.client.Close()
+}
+
+type MemoryHistoryStore struct {
+	mu       sync.RWMutex
+	stations map[string]map[string]Observation
+}
+
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{stations: make(map[string]map[string]Observation)}
+}
+
+func (s *MemoryHistoryStore) Append(ctx context.Context, observations []Observation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appended := 0
+	for _, observation := range observations {
+		if observation.ObservedAt == nil {
+			continue
+		}
+		timestamp := observation.Timestamp()
+		points, ok := s.stations[*observation.Id]
+		if !ok {
+			points = make(map[string]Observation)
+			s.stations[*observation.Id] = points
+		}
+		key := historyKey(timestamp)
+		if _, exists := points[key]; exists {
+			continue
+		}
+		points[key] = observation
+		appended++
+	}
+	return appended, nil
+}
+
+func (s *MemoryHistoryStore) Query(ctx context.Context, stationId string, from time.Time, to time.Time) ([]Observation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var observations []Observation
+	for _, observation := range s.stations[stationId] {
+		observations = append(observations, observation)
+	}
+	return filterHistory(observations, from, to), nil
+}
+
+func (s *MemoryHistoryStore) Close() error {
+	return nil
+}
+
+// FileHistoryStore appends the points as GeoJSON features to one JSON lines
+// file per station.
+type FileHistoryStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileHistoryStore(dir string) *FileHistoryStore {
+	return &FileHistoryStore{dir: dir}
+}
+
+func (s *FileHistoryStore) path(stationId string) string {
+	return filepath.Join(s.dir, url.PathEscape(stationId)+".jsonl")
+}
+
+func (s *FileHistoryStore) Append(ctx context.Context, observations []Observation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byStation := make(map[string][]Observation)
+	for _, observation := range observations {
+		if observation.ObservedAt == nil {
+			continue
+		}
+		byStation[*observation.Id] = append(byStation[*observation.Id], observation)
+	}
+
+	appended := 0
+	for stationId, stationObservations := range byStation {
+		existing, err := s.read(stationId)
+		if err != nil {
+			return appended, err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, observation := range existing {
+			seen[historyKey(observation.Timestamp())] = true
+		}
+
+		var buffer bytes.Buffer
+		for _, observation := range stationObservations {
+			key := historyKey(observation.Timestamp())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			line, err := observation.ToFeature().MarshalJSON()
+			if err != nil {
+				return appended, fmt.Errorf("failed to marshal feature: %w", err)
+			}
+			buffer.Write(line)
+			buffer.WriteByte('\n')
+			appended++
+		}
+		if buffer.Len() == 0 {
+			continue
+		}
+
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return appended, fmt.Errorf("failed to create %s: %w", s.dir, err)
+		}
+		file, err := os.OpenFile(s.path(stationId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return appended, fmt.Errorf("failed to open history of %s: %w", stationId, err)
+		}
+		_, err = file.Write(buffer.Bytes())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return appended, fmt.Errorf("failed to write history of %s: %w", stationId, err)
+		}
+	}
+	return appended, nil
+}
+
+func (s *FileHistoryStore) Query(ctx context.Context, stationId string, from time.Time, to time.Time) ([]Observation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	observations, err := s.read(stationId)
+	if err != nil {
+		return nil, err
+	}
+	return filterHistory(observations, from, to), nil
+}
+
+func (s *FileHistoryStore) Close() error {
+	return nil
+}
+
+func (s *FileHistoryStore) read(stationId string) ([]Observation, error) {
+	file, err := os.Open(s.path(stationId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history of %s: %w", stationId, err)
+	}
+	defer file.Close()
+
+	var observations []Observation
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var feature geojson.Feature
+		if err := json.Unmarshal(scanner.Bytes(), &feature); err != nil {
+			return nil, fmt.Errorf("failed to parse history of %s: %w", stationId, err)
+		}
+		observation, err := ObservationFromFeature(&feature)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse history of %s: %w", stationId, err)
+		}
+		observations = append(observations, observation)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history of %s: %w", stationId, err)
+	}
+	return observations, nil
+}
+
+// filterHistory keeps the observations within [from, to] sorted oldest first.
+func filterHistory(observations []Observation, from time.Time, to time.Time) []Observation {
+	var filtered []Observation
+	for _, observation := range observations {
+		timestamp := observation.Timestamp()
+		if timestamp.Before(from) || timestamp.After(to) {
+			continue
+		}
+		filtered = append(filtered, observation)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Timestamp().Before(filtered[j].Timestamp())
+	})
+	return filtered
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreContract(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	fetchedOnly := testObservation("a", start, floatPtr(0), nil)
+	fetchedOnly.ObservedAt = nil
+	fetchedOnly.FetchedAt = &start
+
+	tests := []struct {
+		name         string
+		observations []Observation
+		appended     int
+	}{
+		{"new points", []Observation{
+			testObservation("a", start.Add(time.Hour), floatPtr(2), nil),
+			testObservation("a", start, floatPtr(1), nil),
+			testObservation("b", start, floatPtr(7), nil),
+		}, 3},
+		{"same points again", []Observation{
+			testObservation("a", start, floatPtr(1), nil),
+			testObservation("b", start, floatPtr(7), nil),
+		}, 0},
+		{"duplicates within a batch", []Observation{
+			testObservation("a", start.Add(2*time.Hour), floatPtr(3), nil),
+			testObservation("a", start.Add(2*time.Hour), floatPtr(3), nil),
+		}, 1},
+		{"without observation time", []Observation{fetchedOnly}, 0},
+	}
+	for backend, stores := range testBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			store := stores.History
+			for _, test := range tests {
+				appended, err := store.Append(ctx, test.observations)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if appended != test.appended {
+					t.Errorf("%s: appended %d, want %d", test.name, appended, test.appended)
+				}
+			}
+
+			observations, err := store.Query(ctx, "a", start, start.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(observations) != 2 {
+				t.Fatalf("got %d points of a, want 2", len(observations))
+			}
+			for i, want := range []float64{1, 2} {
+				if *observations[i].Id != "a" || *observations[i].TemperatureC != want {
+					t.Errorf("point %d = %s %v, want a %v", i, *observations[i].Id, *observations[i].TemperatureC, want)
+				}
+			}
+
+			observations, err = store.Query(ctx, "unknown", start, start.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(observations) != 0 {
+				t.Errorf("got %d points of an unknown station", len(observations))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRequestsPerHost bounds the concurrent requests HTTPClient sends
+// to a single host, to stay polite towards the upstream APIs.
+const DefaultMaxRequestsPerHost = 8
+
+// HTTPClient is shared by the providers for all upstream requests. Requests
+// fail fast while the breaker of their host is open, are retried with backoff
+// and limited per host, in that order.
+var HTTPClient = &http.Client{
+	Timeout: 2 * time.Minute,
+	Transport: NewBreakerTransport(
+		NewRetryTransport(
+			NewHostLimitedTransport(newBaseTransport(), DefaultMaxRequestsPerHost),
+			DefaultRetryPolicy,
+		),
+		HostBreakers,
+	),
+}
+
+// newBaseTransport bounds every single attempt, the client timeout bounds a
+// request including its retries.
+func newBaseTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return transport
+}
+
+// hostLimitedTransport allows at most limit requests in flight per host,
+// further requests wait for a slot or until their context is cancelled.
+type hostLimitedTransport struct {
+	base  http.RoundTripper
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func NewHostLimitedTransport(base http.RoundTripper, limit int) http.RoundTripper {
+	return &hostLimitedTransport{base: base, limit: limit, slots: make(map[string]chan struct{})}
+}
+
+func (t *hostLimitedTransport) hostSlots(host string) chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	slots, ok := t.slots[host]
+	if !ok {
+		slots = make(chan struct{}, t.limit)
+		t.slots[host] = slots
+	}
+	return slots
+}
+
+func (t *hostLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := t.hostSlots(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		<-slots
+		return nil, err
+	}
+	// Hold the slot until the body has been read and closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-slots }}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
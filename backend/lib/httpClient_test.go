@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimitedTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		requests int
+	}{
+		{"one at a time", 1, 4},
+		{"below the limit", 8, 3},
+		{"above the limit", 3, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					seen := maxInFlight.Load()
+					if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewHostLimitedTransport(http.DefaultTransport, test.limit)}
+			var wg sync.WaitGroup
+			for i := 0; i < test.requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := client.Get(server.URL)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp.Body.Close()
+				}()
+			}
+			wg.Wait()
+
+			if got, want := int(maxInFlight.Load()), min(test.limit, test.requests); got != want {
+				t.Errorf("%d requests in flight, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHostLimitedTransportWaitsForBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewHostLimitedTransport(http.DefaultTransport, 1)}
+	first, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The open body holds the only slot
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the request to wait for a slot until its deadline", err)
+	}
+
+	first.Body.Close()
+	second, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+}
+
+func TestHTTPClientRetriesBeforeOpeningBreaker(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Assembled like HTTPClient, with short delays
+	breakers := NewCircuitBreakers(2, time.Minute)
+	client := &http.Client{
+		Transport: NewBreakerTransport(
+			NewRetryTransport(
+				NewHostLimitedTransport(http.DefaultTransport, DefaultMaxRequestsPerHost),
+				RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			),
+			breakers,
+		),
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The breaker counts requests including their retries as one failure
+	if got := requests.Load(); got != 6 {
+		t.Errorf("%d requests reached the host, want 6", got)
+	}
+	var openErr *CircuitOpenError
+	if _, err := client.Get(server.URL); !errors.As(err, &openErr) {
+		t.Errorf("got %v, want a CircuitOpenError", err)
+	}
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Resize scales the image to width x height by averaging the source pixels
+// covered by every target pixel, which keeps detail when shrinking webcam
+// images a lot. Enlarging repeats pixels.
+func Resize(src image.Image, width int, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	} else if bounds.Min != (image.Point{}) {
+		rgba = rgba.SubImage(bounds).(*image.RGBA)
+	}
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(rgba.Rect.Min.X+x0, rgba.Rect.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(rgba.Pix[offset])
+					g += uint32(rgba.Pix[offset+1])
+					b += uint32(rgba.Pix[offset+2])
+					a += uint32(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / count), uint8(g / count), uint8(b / count), uint8(a / count)})
+		}
+	}
+	return dst
+}
+
+// ResizeToWidth scales the image to the width, keeping its aspect ratio.
+func ResizeToWidth(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	return Resize(src, width, height)
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HistogramBins is the number of brightness ranges in ImageStats.Histogram.
+const HistogramBins = 16
+
+// statsWidth is the width frames are downscaled to before measuring, so the
+// scores do not depend on the resolution of the camera.
+const statsWidth = 320
+
+// edgeThreshold is the gradient magnitude, in luma per pixel, above which a
+// pixel is counted as an edge.
+const edgeThreshold = 0.1
+
+// ImageStats describes the brightness and detail of a webcam frame. All
+// values are between 0 and 1.
+type ImageStats struct {
+	// Brightness is the mean luma.
+	Brightness float64
+	// Contrast is the standard deviation of the luma.
+	Contrast float64
+	// EdgeDensity is the share of pixels on an edge.
+	EdgeDensity float64
+	// Histogram is the share of pixels per brightness range, darkest first.
+	Histogram [HistogramBins]float64
+	// Visibility is high for clear views and low for fog, flat light or a
+	// covered lens, from the contrast, edges and spread of the histogram.
+	Visibility float64
+	// Sharpness is the mean response of a Laplacian filter, low for blurry
+	// or foggy frames.
+	Sharpness float64
+}
+
+// MeasureImage computes the stats of a frame on a grayscale copy downscaled
+// to statsWidth.
+func MeasureImage(img image.Image) ImageStats {
+	if img.Bounds().Dx() > statsWidth {
+		img = ResizeToWidth(img, statsWidth)
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var stats ImageStats
+	if width == 0 || height == 0 {
+		return stats
+	}
+
+	luma := make([]float64, width*height)
+	var sum float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			value := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+			luma[y*width+x] = value
+			sum += value
+			stats.Histogram[min(int(value*HistogramBins), HistogramBins-1)]++
+		}
+	}
+	pixels := float64(len(luma))
+	stats.Brightness = sum / pixels
+
+	var variance float64
+	for _, value := range luma {
+		variance += (value - stats.Brightness) * (value - stats.Brightness)
+	}
+	stats.Contrast = math.Sqrt(variance / pixels)
+	for i := range stats.Histogram {
+		stats.Histogram[i] /= pixels
+	}
+
+	// Sobel gradients and the 4-neighbour Laplacian of the inner pixels
+	var edges, laplacian float64
+	at := func(x int, y int) float64 { return luma[y*width+x] }
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			if math.Hypot(gx, gy)/4 > edgeThreshold {
+				edges++
+			}
+			laplacian += math.Abs(at(x-1, y) + at(x+1, y) + at(x, y-1) + at(x, y+1) - 4*at(x, y))
+		}
+	}
+	if inner := float64((width - 2) * (height - 2)); inner > 0 {
+		stats.EdgeDensity = edges / inner
+		stats.Sharpness = clamp01(laplacian / inner / 0.05)
+	}
+
+	// A clear view has a contrast of about 0.2, edges on a tenth of the
+	// pixels and a histogram spread over most of the range
+	stats.Visibility = clamp01(0.4*stats.Contrast/0.2 + 0.3*stats.EdgeDensity/0.1 + 0.3*stats.spread()/0.6)
+	return stats
+}
+
+// spread is the brightness range between the 5th and 95th percentile.
+func (stats ImageStats) spread() float64 {
+	var low, high float64
+	var cumulative float64
+	for i, share := range stats.Histogram {
+		if cumulative < 0.05 && cumulative+share >= 0.05 {
+			low = float64(i) / HistogramBins
+		}
+		if cumulative < 0.95 && cumulative+share >= 0.95 {
+			high = float64(i+1) / HistogramBins
+		}
+		cumulative += share
+	}
+	return max(0, high-low)
+}
+
+// Metadata formats the stats as webcam image metadata.
+func (stats ImageStats) Metadata() map[string]string {
+	histogram := make([]string, len(stats.Histogram))
+	for i, share := range stats.Histogram {
+		histogram[i] = strconv.FormatFloat(share, 'f', 3, 64)
+	}
+	return map[string]string{
+		"brightness":  fmt.Sprintf("%.3f", stats.Brightness),
+		"contrast":    fmt.Sprintf("%.3f", stats.Contrast),
+		"edgeDensity": fmt.Sprintf("%.3f", stats.EdgeDensity),
+		"histogram":   strings.Join(histogram, ","),
+		"visibility":  fmt.Sprintf("%.2f", stats.Visibility),
+		"sharpness":   fmt.Sprintf("%.2f", stats.Sharpness),
+	}
+}
+
+func clamp01(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func uniformImage(width int, height int, value uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = value
+	}
+	return img
+}
+
+// stripedImage has vertical black and white stripes of the width.
+func stripedImage(width int, height int, stripe int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x/stripe%2 == 1 {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestMeasureImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		brightness float64
+		contrast   float64
+		// histogram holds the expected shares of the darkest and brightest bins
+		histogram     [2]float64
+		edges         bool
+		minVisibility float64
+		maxVisibility float64
+	}{
+		{"black", uniformImage(64, 48, 0), 0, 0, [2]float64{1, 0}, false, 0, 0.1},
+		{"white", uniformImage(64, 48, 255), 1, 0, [2]float64{0, 1}, false, 0, 0.1},
+		{"gray", uniformImage(64, 48, 128), 128.0 / 255, 0, [2]float64{0, 0}, false, 0, 0.1},
+		{"downscaled", uniformImage(1280, 720, 128), 128.0 / 255, 0, [2]float64{0, 0}, false, 0, 0.1},
+		{"stripes", stripedImage(64, 48, 8), 0.5, 0.5, [2]float64{0.5, 0.5}, true, 1, 1},
+		{"empty", image.NewGray(image.Rect(0, 0, 0, 0)), 0, 0, [2]float64{0, 0}, false, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := MeasureImage(test.img)
+			if math.Abs(stats.Brightness-test.brightness) > 0.01 {
+				t.Errorf("brightness = %.3f, want %.3f", stats.Brightness, test.brightness)
+			}
+			if math.Abs(stats.Contrast-test.contrast) > 0.01 {
+				t.Errorf("contrast = %.3f, want %.3f", stats.Contrast, test.contrast)
+			}
+			if darkest, brightest := stats.Histogram[0], stats.Histogram[HistogramBins-1]; math.Abs(darkest-test.histogram[0]) > 0.01 || math.Abs(brightest-test.histogram[1]) > 0.01 {
+				t.Errorf("histogram = %v, want %v at the ends", stats.Histogram, test.histogram)
+			}
+			if (stats.EdgeDensity > 0) != test.edges || (stats.Sharpness > 0) != test.edges {
+				t.Errorf("edge density = %.3f and sharpness = %.3f, want edges %v", stats.EdgeDensity, stats.Sharpness, test.edges)
+			}
+			if stats.Visibility < test.minVisibility || stats.Visibility > test.maxVisibility {
+				t.Errorf("visibility = %.3f, want [%.1f, %.1f]", stats.Visibility, test.minVisibility, test.maxVisibility)
+			}
+		})
+	}
+}
+
+func TestImageStatsMetadata(t *testing.T) {
+	metadata := MeasureImage(stripedImage(64, 48, 8)).Metadata()
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"brightness", "0.500"},
+		{"contrast", "0.500"},
+		{"visibility", "1.00"},
+		{"histogram", "0.500,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.000,0.500"},
+	}
+	for _, test := range tests {
+		if got := metadata[test.key]; got != test.want {
+			t.Errorf("%s = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// ErrImageNotFound is returned by Get for keys without an image.
+var ErrImageNotFound = errors.New("image not found")
+
+// ImageStore keeps webcam images and their metadata under slash separated
+// keys, e.g. history/webcam-borga/20241201T120000Z.jpg.
+type ImageStore interface {
+	Put(ctx context.Context, key string, data []byte, options PutOptions) error
+	Get(ctx context.Context, key string) ([]byte, ImageInfo, error)
+	// Stat returns the info of the image without reading it.
+	Stat(ctx context.Context, key string) (ImageInfo, error)
+	// List returns the images whose key starts with the prefix. Unless
+	// recursive, keys with a slash after the prefix are left out.
+	List(ctx context.Context, prefix string, recursive bool) ([]ImageInfo, error)
+	// UpdateMetadata merges the metadata into that of the image, keys with
+	// an empty value are removed.
+	UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error
+	// Delete removes the image, deleting a missing image is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is where clients can load the image stored under the key.
+	URL(key string) string
+	Close() error
+}
+
+type PutOptions struct {
+	ContentType  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+type ImageInfo struct {
+	Key          string            `json:"key"`
+	URL          string            `json:"url"`
+	ContentType  string            `json:"contentType"`
+	CacheControl string            `json:"cacheControl,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Size         int64             `json:"size"`
+	Updated      time.Time         `json:"updated"`
+}
+
+const (
+	ImageBackendFirebase = "firebase"
+	ImageBackendLocal    = "local"
+)
+
+// OpenImageStore opens the image store selected by the config.
+func OpenImageStore(ctx context.Context, config StoreConfig) (ImageStore, error) {
+	switch config.ImageBackend {
+	case ImageBackendFirebase:
+		return NewFirebaseImageStore(ctx)
+	case ImageBackendLocal:
+		return NewLocalImageStore(filepath.Join(config.Dir, "images"), config.ImageBaseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown image backend %q", config.ImageBackend)
+	}
+}
+
+// FirebaseImageStore keeps the images in the default bucket of the shared
+// Firebase app, publicly readable at storage.googleapis.com.
+type FirebaseImageStore struct {
+	bucket *storage.BucketHandle
+}
+
+func NewFirebaseImageStore(ctx context.Context) (*FirebaseImageStore, error) {
+	app, err := FirebaseApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := app.Storage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Firebase storage client: %w", err)
+	}
+
+	bucket, err := client.DefaultBucket()
+	if err != nil {
+		return nil, fmt.Errorf("error getting default Firebase storage bucket: %w", err)
+	}
+	return &FirebaseImageStore{bucket: bucket}, nil
+}
+
+func (s *FirebaseImageStore) URL(key string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket.BucketName(), key)
+}
+
+func (s *FirebaseImageStore) info(attrs *storage.ObjectAttrs) ImageInfo {
+	return ImageInfo{
+		Key:          attrs.Name,
+		URL:          s.URL(attrs.Name),
+		ContentType:  attrs.ContentType,
+		CacheControl: attrs.CacheControl,
+		Metadata:     attrs.Metadata,
+		Size:         attrs.Size,
+		Updated:      attrs.Updated,
+	}
+}
+
+func (s *FirebaseImageStore) Put(ctx context.Context, key string, data []byte, options PutOptions) error {
+	writer := s.bucket.Object(key).NewWriter(ctx)
+	writer.ObjectAttrs.Metadata = options.Metadata
+	writer.ObjectAttrs.CacheControl = options.CacheControl
+	writer.ObjectAttrs.ContentType = options.ContentType
+
+	if _, err := io.Copy(writer, bytes.NewReader(data)); err != nil {
+		writer.Close()
+		return fmt.Errorf("error writing %s to Firebase storage: %w", key, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error writing %s to Firebase storage: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FirebaseImageStore) Get(ctx context.Context, key string) ([]byte, ImageInfo, error) {
+	reader, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ImageInfo{}, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("error reading attributes of %s: %w", key, err)
+	}
+	return data, s.info(attrs), nil
+}
+
+func (s *FirebaseImageStore) Stat(ctx context.Context, key string) (ImageInfo, error) {
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ImageInfo{}, ErrImageNotFound
+	}
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("error reading attributes of %s: %w", key, err)
+	}
+	return s.info(attrs), nil
+}
+
+func (s *FirebaseImageStore) List(ctx context.Context, prefix string, recursive bool) ([]ImageInfo, error) {
+	query := &storage.Query{Prefix: prefix}
+	if !recursive {
+		query.Delimiter = "/"
+	}
+
+	var images []ImageInfo
+	it := s.bucket.Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+		// Directories are listed as prefixes when not recursive
+		if attrs.Prefix != "" {
+			continue
+		}
+		images = append(images, s.info(attrs))
+	}
+	return images, nil
+}
+
+func (s *FirebaseImageStore) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	_, err := s.bucket.Object(key).Update(ctx, storage.ObjectAttrsToUpdate{Metadata: metadata})
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrImageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error updating metadata of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FirebaseImageStore) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FirebaseImageStore) Close() error {
+	return nil
+}
+
+// LocalImageStore keeps the images as files under a directory, with the
+// options of every image in a JSON file under .metadata.
+type LocalImageStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalImageStore(dir string, baseURL string) *LocalImageStore {
+	return &LocalImageStore{dir: dir, baseURL: baseURL}
+}
+
+const localMetadataDir = ".metadata"
+
+func (s *LocalImageStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) ||
+		cleaned == localMetadataDir || strings.HasPrefix(cleaned, localMetadataDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid image key %q", key)
+	}
+	return filepath.Join(s.dir, cleaned), nil
+}
+
+func (s *LocalImageStore) metadataPath(key string) string {
+	return filepath.Join(s.dir, localMetadataDir, filepath.FromSlash(key)+".json")
+}
+
+func (s *LocalImageStore) info(key string, fileInfo fs.FileInfo) ImageInfo {
+	options := s.options(key)
+	return ImageInfo{
+		Key:          key,
+		URL:          s.URL(key),
+		ContentType:  options.ContentType,
+		CacheControl: options.CacheControl,
+		Metadata:     options.Metadata,
+		Size:         fileInfo.Size(),
+		Updated:      fileInfo.ModTime().UTC(),
+	}
+}
+
+// options reads the options the image was stored with, images without a
+// readable metadata file have none.
+func (s *LocalImageStore) options(key string) PutOptions {
+	var options PutOptions
+	if data, err := os.ReadFile(s.metadataPath(key)); err == nil {
+		json.Unmarshal(data, &options)
+	}
+	return options
+}
+
+func (s *LocalImageStore) URL(key string) string {
+	return s.baseURL + url.QueryEscape(key)
+}
+
+func (s *LocalImageStore) Put(ctx context.Context, key string, data []byte, options PutOptions) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of %s: %w", key, err)
+	}
+	if err := writeFileAtomic(s.metadataPath(key), metadata); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (s *LocalImageStore) Get(ctx context.Context, key string) ([]byte, ImageInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, ImageInfo{}, err
+	}
+	path, _ := s.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, info, nil
+}
+
+func (s *LocalImageStore) Stat(ctx context.Context, key string) (ImageInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ImageInfo{}, ErrImageNotFound
+	}
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && fileInfo.IsDir()) {
+		return ImageInfo{}, ErrImageNotFound
+	}
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return s.info(key, fileInfo), nil
+}
+
+func (s *LocalImageStore) List(ctx context.Context, prefix string, recursive bool) ([]ImageInfo, error) {
+	images := []ImageInfo{}
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(s.dir, path)
+		key := filepath.ToSlash(relative)
+		if entry.IsDir() {
+			if key == localMetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || (!recursive && strings.Contains(key[len(prefix):], "/")) {
+			return nil
+		}
+		// Skip files of interrupted writes
+		if strings.HasSuffix(key, ".tmp") {
+			return nil
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		images = append(images, s.info(key, fileInfo))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Key < images[j].Key
+	})
+	return images, nil
+}
+
+func (s *LocalImageStore) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	options := s.options(key)
+	if options.Metadata == nil {
+		options.Metadata = make(map[string]string)
+	}
+	for name, value := range metadata {
+		if value == "" {
+			delete(options.Metadata, name)
+		} else {
+			options.Metadata[name] = value
+		}
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of %s: %w", key, err)
+	}
+	return writeFileAtomic(s.metadataPath(key), data)
+}
+
+func (s *LocalImageStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	if err := os.Remove(s.metadataPath(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete metadata of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalImageStore) Close() error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalImageStorePath(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalImageStore(dir, "")
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "webcam.jpg", want: "webcam.jpg"},
+		{key: "history/webcam/20241201T120000Z.jpg", want: filepath.Join("history", "webcam", "20241201T120000Z.jpg")},
+		{key: ".metadata-like.jpg", want: ".metadata-like.jpg"},
+		{key: ".metadataCam/image.jpg", want: filepath.Join(".metadataCam", "image.jpg")},
+		{key: "", wantErr: true},
+		{key: "./", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+		{key: "..", wantErr: true},
+		{key: "../outside.jpg", wantErr: true},
+		{key: "webcams/../../outside.jpg", wantErr: true},
+		{key: ".metadata", wantErr: true},
+		{key: ".metadata/webcam.jpg.json", wantErr: true},
+		{key: "./.metadata/webcam.jpg.json", wantErr: true},
+		{key: "webcams/../.metadata/webcam.jpg.json", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			path, err := store.path(test.key)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, test.want); path != want {
+				t.Errorf("got %s, want %s", path, want)
+			}
+		})
+	}
+}
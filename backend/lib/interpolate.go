@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// StandardLapseRate is the average temperature decrease with height, in °C per metre.
+const StandardLapseRate = 0.0065
+
+// Grid is a regular longitude/latitude grid of values. Values are stored row
+// by row starting in the north west corner, NaN marks cells without an estimate.
+type Grid struct {
+	Bounds  BoundingBox
+	Columns int
+	Rows    int
+	Values  []float64
+}
+
+func NewGrid(bounds BoundingBox, columns int, rows int) *Grid {
+	values := make([]float64, columns*rows)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return &Grid{Bounds: bounds, Columns: columns, Rows: rows, Values: values}
+}
+
+func (grid *Grid) cellWidth() float64 {
+	return (grid.Bounds.MaxLongitude - grid.Bounds.MinLongitude) / float64(grid.Columns)
+}
+
+func (grid *Grid) cellHeight() float64 {
+	return (grid.Bounds.MaxLatitude - grid.Bounds.MinLatitude) / float64(grid.Rows)
+}
+
+// CellCenter returns the longitude and latitude of the center of the cell.
+func (grid *Grid) CellCenter(column int, row int) (float64, float64) {
+	longitude := grid.Bounds.MinLongitude + (float64(column)+0.5)*grid.cellWidth()
+	latitude := grid.Bounds.MaxLatitude - (float64(row)+0.5)*grid.cellHeight()
+	return longitude, latitude
+}
+
+func (grid *Grid) Get(column int, row int) float64 {
+	return grid.Values[row*grid.Columns+column]
+}
+
+func (grid *Grid) Set(column int, row int, value float64) {
+	grid.Values[row*grid.Columns+column] = value
+}
+
+// At samples the grid at the coordinate by bilinear interpolation between the
+// surrounding cell centers. It returns NaN outside the grid or next to cells
+// without an estimate.
+func (grid *Grid) At(longitude float64, latitude float64) float64 {
+	if !grid.Bounds.Contains(longitude, latitude) {
+		return math.NaN()
+	}
+	x := (longitude-grid.Bounds.MinLongitude)/grid.cellWidth() - 0.5
+	y := (grid.Bounds.MaxLatitude-latitude)/grid.cellHeight() - 0.5
+	x = math.Max(0, math.Min(x, float64(grid.Columns-1)))
+	y = math.Max(0, math.Min(y, float64(grid.Rows-1)))
+
+	column, row := int(x), int(y)
+	nextColumn, nextRow := min(column+1, grid.Columns-1), min(row+1, grid.Rows-1)
+	fx, fy := x-float64(column), y-float64(row)
+
+	top := grid.Get(column, row)*(1-fx) + grid.Get(nextColumn, row)*fx
+	bottom := grid.Get(column, nextRow)*(1-fx) + grid.Get(nextColumn, nextRow)*fx
+	return top*(1-fy) + bottom*fy
+}
+
+// ToFeatureCollection returns one polygon feature per cell with an estimate,
+// with the estimate in the property named after the interpolated property.
+func (grid *Grid) ToFeatureCollection(property string) *geojson.FeatureCollection {
+	collection := geojson.NewFeatureCollection()
+	width, height := grid.cellWidth(), grid.cellHeight()
+	for row := 0; row < grid.Rows; row++ {
+		for column := 0; column < grid.Columns; column++ {
+			value := grid.Get(column, row)
+			if math.IsNaN(value) {
+				continue
+			}
+			west := grid.Bounds.MinLongitude + float64(column)*width
+			north := grid.Bounds.MaxLatitude - float64(row)*height
+			east, south := west+width, north-height
+			feature := geojson.NewPolygonFeature([][][]float64{{
+				{west, south}, {east, south}, {east, north}, {west, north}, {west, south},
+			}})
+			feature.SetProperty(property, math.Round(value*10)/10)
+			collection.AddFeature(feature)
+		}
+	}
+	return collection
+}
+
+type InterpolationOptions struct {
+	// Power of the inverse distance weighting, 2 is the common choice.
+	Power float64
+	// MaxDistanceKm leaves cells without any observation within this distance
+	// empty. Zero disables the limit.
+	MaxDistanceKm float64
+	// LapseRate in °C per metre corrects temperatures for the elevation of the
+	// stations and cells. It needs Elevation, zero disables the correction.
+	LapseRate float64
+	// Elevation returns the terrain height in metres at a coordinate, e.g.
+	// from a DEM. It is used for the cells and for stations without an
+	// elevation of their own.
+	Elevation func(longitude float64, latitude float64) (float64, bool)
+}
+
+var DefaultInterpolationOptions = InterpolationOptions{Power: 2, MaxDistanceKm: 60}
+
+type samplePoint struct {
+	longitude float64
+	latitude  float64
+	value     float64
+}
+
+// InterpolateIDW estimates the property for every cell of a grid over the
+// bounds by inverse distance weighting of the observations reporting it.
+//
+// With a lapse rate and a terrain elevation, values are first reduced to sea
+// level using the station elevation, interpolated, and then brought back to
+// the terrain elevation of the cell.
+func InterpolateIDW(observations []Observation, property string, bounds BoundingBox, columns int, rows int, options InterpolationOptions) (*Grid, error) {
+	if columns <= 0 || rows <= 0 {
+		return nil, fmt.Errorf("grid must have at least one cell, got %dx%d", columns, rows)
+	}
+
+	// Heights interpolated from the stations themselves would undo the
+	// reduction, so the correction needs a terrain source
+	elevationAt := options.Elevation
+	correct := options.LapseRate != 0 && elevationAt != nil
+
+	var samples []samplePoint
+	for _, observation := range observations {
+		value := observation.Value(property)
+		if value == nil {
+			continue
+		}
+		sample := samplePoint{*observation.Longitude, *observation.Latitude, *value}
+		if correct {
+			elevation, ok := 0.0, false
+			if observation.Elevation != nil {
+				elevation, ok = *observation.Elevation, true
+			} else {
+				elevation, ok = elevationAt(sample.longitude, sample.latitude)
+			}
+			if !ok {
+				continue
+			}
+			sample.value += options.LapseRate * elevation
+		}
+		samples = append(samples, sample)
+	}
+
+	grid := NewGrid(bounds, columns, rows)
+	if len(samples) == 0 {
+		return grid, nil
+	}
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			longitude, latitude := grid.CellCenter(column, row)
+			value, ok := idw(samples, longitude, latitude, options.Power, options.MaxDistanceKm)
+			if !ok {
+				continue
+			}
+			if correct {
+				elevation, ok := elevationAt(longitude, latitude)
+				if !ok {
+					continue
+				}
+				value -= options.LapseRate * elevation
+			}
+			grid.Set(column, row, value)
+		}
+	}
+	return grid, nil
+}
+
+func idw(samples []samplePoint, longitude float64, latitude float64, power float64, maxDistanceKm float64) (float64, bool) {
+	var weightedSum, weightSum float64
+	nearest := math.Inf(1)
+	for _, sample := range samples {
+		distance := distanceKm(longitude, latitude, sample.longitude, sample.latitude)
+		if distance < 1e-6 {
+			return sample.value, true
+		}
+		nearest = math.Min(nearest, distance)
+		weight := 1 / math.Pow(distance, power)
+		weightedSum += weight * sample.value
+		weightSum += weight
+	}
+	if weightSum == 0 || (maxDistanceKm > 0 && nearest > maxDistanceKm) {
+		return 0, false
+	}
+	return weightedSum / weightSum, true
+}
+
+// distanceKm is the equirectangular approximation of the distance between two
+// coordinates, accurate enough at the scale of a region.
+func distanceKm(longitude1 float64, latitude1 float64, longitude2 float64, latitude2 float64) float64 {
+	const earthRadiusKm = 6371
+	meanLatitude := (latitude1 + latitude2) / 2 * math.Pi / 180
+	x := (longitude2 - longitude1) * math.Pi / 180 * math.Cos(meanLatitude)
+	y := (latitude2 - latitude1) * math.Pi / 180
+	return math.Sqrt(x*x+y*y) * earthRadiusKm
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInterpolateIDWLapseRate(t *testing.T) {
+	station := func(id string, longitude float64, elevation *float64, temperature float64) Observation {
+		latitude := 63.4
+		return Observation{Id: &id, Longitude: &longitude, Latitude: &latitude, Elevation: elevation, TemperatureC: &temperature}
+	}
+	// A valley and a summit station at the same distance from the one cell,
+	// their temperatures follow the standard lapse rate
+	valley := station("valley", 13.0, floatPtr(400), 6)
+	summit := station("summit", 13.2, floatPtr(1400), -0.5)
+	bounds := BoundingBox{MinLongitude: 13.05, MinLatitude: 63.35, MaxLongitude: 13.15, MaxLatitude: 63.45}
+	terrain := func(height float64) func(float64, float64) (float64, bool) {
+		return func(longitude float64, latitude float64) (float64, bool) {
+			if longitude == 13.2 {
+				return 1400, true
+			}
+			return height, true
+		}
+	}
+	tests := []struct {
+		name         string
+		observations []Observation
+		lapseRate    float64
+		elevation    func(float64, float64) (float64, bool)
+		want         float64
+	}{
+		{"without lapse rate", []Observation{valley, summit}, 0, terrain(1400), 2.75},
+		{"without terrain", []Observation{valley, summit}, StandardLapseRate, nil, 2.75},
+		{"cell on the summit", []Observation{valley, summit}, StandardLapseRate, terrain(1400), -0.5},
+		{"cell in the valley", []Observation{valley, summit}, StandardLapseRate, terrain(400), 6},
+		{"station elevation from the terrain", []Observation{valley, station("summit", 13.2, nil, -0.5)}, StandardLapseRate, terrain(900), 2.75},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := DefaultInterpolationOptions
+			options.LapseRate = test.lapseRate
+			options.Elevation = test.elevation
+			grid, err := InterpolateIDW(test.observations, "temperature_c", bounds, 1, 1, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := grid.Get(0, 0); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got %.3f °C, want %.3f °C", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateIDW(t *testing.T) {
+	id, longitude, latitude, temperature := "a", 13.0, 63.4, -3.0
+	observations := []Observation{{Id: &id, Longitude: &longitude, Latitude: &latitude, TemperatureC: &temperature}}
+	tests := []struct {
+		name    string
+		bounds  BoundingBox
+		columns int
+		rows    int
+		// want is the value of the first cell, NaN when it is empty
+		want    float64
+		wantErr bool
+	}{
+		{"near the station", BoundingBox{MinLongitude: 12.9, MinLatitude: 63.3, MaxLongitude: 13.1, MaxLatitude: 63.5}, 1, 1, -3, false},
+		{"beyond the max distance", BoundingBox{MinLongitude: 15, MinLatitude: 63.3, MaxLongitude: 15.2, MaxLatitude: 63.5}, 1, 1, math.NaN(), false},
+		{"no cells", BoundingBox{MinLongitude: 12.9, MinLatitude: 63.3, MaxLongitude: 13.1, MaxLatitude: 63.5}, 0, 1, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := InterpolateIDW(observations, "temperature_c", test.bounds, test.columns, test.rows, DefaultInterpolationOptions)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := grid.Get(0, 0)
+			if math.IsNaN(test.want) != math.IsNaN(got) || (!math.IsNaN(got) && math.Abs(got-test.want) > 1e-9) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
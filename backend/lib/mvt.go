@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// Encoding of Mapbox Vector Tiles, see
+// https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+const (
+	mvtExtent = 4096
+	// mvtBuffer is how far outside the tile, in tile units, points are still
+	// included so that symbols on the tile edge are not cut off.
+	mvtBuffer = 256
+
+	ObservationLayerName = "observations"
+)
+
+type TileOptions struct {
+	// ClusterMaxZoom is the highest zoom level where nearby points are thinned.
+	ClusterMaxZoom int
+	// ClusterRadius is the size, in tile units, of the grid cells points are
+	// thinned to. Each cell keeps the point with the most values and counts
+	// the points it represents in point_count.
+	ClusterRadius int
+}
+
+var DefaultTileOptions = TileOptions{ClusterMaxZoom: 9, ClusterRadius: 256}
+
+type tilePoint struct {
+	observation Observation
+	x           int
+	y           int
+	count       int
+}
+
+// EncodeObservationTile encodes the observations within the tile as point
+// features of a vector tile layer named ObservationLayerName. The feature
+// properties use the same names as the stored GeoJSON.
+func EncodeObservationTile(observations []Observation, tile TileCoordinate, options TileOptions) []byte {
+	var points []*tilePoint
+	for _, observation := range observations {
+		tileX, tileY := tile.Project(*observation.Longitude, *observation.Latitude)
+		x := int(math.Round(tileX * mvtExtent))
+		y := int(math.Round(tileY * mvtExtent))
+		if x < -mvtBuffer || x > mvtExtent+mvtBuffer || y < -mvtBuffer || y > mvtExtent+mvtBuffer {
+			continue
+		}
+		points = append(points, &tilePoint{observation: observation, x: x, y: y, count: 1})
+	}
+
+	if tile.Z <= options.ClusterMaxZoom && options.ClusterRadius > 0 {
+		points = thinPoints(points, options.ClusterRadius)
+	}
+
+	layer := newMvtLayer(ObservationLayerName)
+	for i, point := range points {
+		properties := point.observation.ToFeature().Properties
+		properties["id"] = *point.observation.Id
+		if tile.Z <= options.ClusterMaxZoom {
+			properties["point_count"] = point.count
+		}
+		layer.addPoint(uint64(i+1), point.x, point.y, properties)
+	}
+
+	var tileBuffer protoBuffer
+	tileBuffer.bytesField(3, layer.encode())
+	return tileBuffer
+}
+
+func thinPoints(points []*tilePoint, radius int) []*tilePoint {
+	type cell struct{ x, y int }
+	cells := make(map[cell]*tilePoint)
+	var order []cell
+	for _, point := range points {
+		key := cell{floorDiv(point.x, radius), floorDiv(point.y, radius)}
+		existing, ok := cells[key]
+		if !ok {
+			cells[key] = point
+			order = append(order, key)
+			continue
+		}
+		count := existing.count + point.count
+		if valueCount(point.observation) > valueCount(existing.observation) {
+			existing = point
+		}
+		existing.count = count
+		cells[key] = existing
+	}
+
+	thinned := make([]*tilePoint, 0, len(order))
+	for _, key := range order {
+		thinned = append(thinned, cells[key])
+	}
+	return thinned
+}
+
+func floorDiv(a int, b int) int {
+	return int(math.Floor(float64(a) / float64(b)))
+}
+
+func valueCount(observation Observation) int {
+	count := 0
+	for _, property := range MeasurementProperties {
+		if observation.Value(property) != nil {
+			count++
+		}
+	}
+	return count
+}
+
+type mvtLayer struct {
+	name     string
+	features protoBuffer
+	keys     []string
+	keyIndex map[string]uint64
+	values   []protoBuffer
+	valIndex map[interface{}]uint64
+}
+
+func newMvtLayer(name string) *mvtLayer {
+	return &mvtLayer{name: name, keyIndex: make(map[string]uint64), valIndex: make(map[interface{}]uint64)}
+}
+
+func (layer *mvtLayer) key(key string) uint64 {
+	if index, ok := layer.keyIndex[key]; ok {
+		return index
+	}
+	index := uint64(len(layer.keys))
+	layer.keys = append(layer.keys, key)
+	layer.keyIndex[key] = index
+	return index
+}
+
+func (layer *mvtLayer) value(value interface{}) (uint64, bool) {
+	var normalized interface{}
+	var encoded protoBuffer
+	switch v := value.(type) {
+	case string:
+		normalized = v
+		encoded.stringField(1, v)
+	case float64:
+		normalized = v
+		encoded.doubleField(3, v)
+	case int:
+		normalized = int64(v)
+		encoded.varintField(6, zigzag(int64(v)))
+	case bool:
+		normalized = v
+		encoded.boolField(7, v)
+	case time.Time:
+		return layer.value(v.UTC().Format(time.RFC3339))
+	default:
+		return 0, false
+	}
+
+	if index, ok := layer.valIndex[normalized]; ok {
+		return index, true
+	}
+	index := uint64(len(layer.values))
+	layer.values = append(layer.values, encoded)
+	layer.valIndex[normalized] = index
+	return index, true
+}
+
+func (layer *mvtLayer) addPoint(id uint64, x int, y int, properties map[string]interface{}) {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tags []uint64
+	for _, key := range keys {
+		valueIndex, ok := layer.value(properties[key])
+		if !ok {
+			continue
+		}
+		tags = append(tags, layer.key(key), valueIndex)
+	}
+
+	// A single MoveTo command with one point
+	geometry := []uint64{1&0x7 | 1<<3, zigzag(int64(x)), zigzag(int64(y))}
+
+	var feature protoBuffer
+	feature.varintField(1, id)
+	feature.packedField(2, tags)
+	feature.varintField(3, 1) // POINT
+	feature.packedField(4, geometry)
+	layer.features.bytesField(2, feature)
+}
+
+func (layer *mvtLayer) encode() []byte {
+	var buffer protoBuffer
+	buffer.varintField(15, 2)
+	buffer.stringField(1, layer.name)
+	buffer = append(buffer, layer.features...)
+	for _, key := range layer.keys {
+		buffer.stringField(3, key)
+	}
+	for _, value := range layer.values {
+		buffer.bytesField(4, value)
+	}
+	buffer.varintField(5, mvtExtent)
+	return buffer
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+// protoBuffer is a minimal protocol buffers writer, enough for vector tiles.
+type protoBuffer []byte
+
+func (buffer *protoBuffer) varint(value uint64) {
+	*buffer = binary.AppendUvarint(*buffer, value)
+}
+
+func (buffer *protoBuffer) tag(field int, wireType int) {
+	buffer.varint(uint64(field<<3 | wireType))
+}
+
+func (buffer *protoBuffer) varintField(field int, value uint64) {
+	buffer.tag(field, 0)
+	buffer.varint(value)
+}
+
+func (buffer *protoBuffer) boolField(field int, value bool) {
+	if value {
+		buffer.varintField(field, 1)
+	} else {
+		buffer.varintField(field, 0)
+	}
+}
+
+func (buffer *protoBuffer) doubleField(field int, value float64) {
+	buffer.tag(field, 1)
+	*buffer = binary.LittleEndian.AppendUint64(*buffer, math.Float64bits(value))
+}
+
+func (buffer *protoBuffer) bytesField(field int, value []byte) {
+	buffer.tag(field, 2)
+	buffer.varint(uint64(len(value)))
+	*buffer = append(*buffer, value...)
+}
+
+func (buffer *protoBuffer) stringField(field int, value string) {
+	buffer.bytesField(field, []byte(value))
+}
+
+func (buffer *protoBuffer) packedField(field int, values []uint64) {
+	var packed protoBuffer
+	for _, value := range values {
+		packed.varint(value)
+	}
+	buffer.bytesField(field, packed)
+}
@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// protoField is a decoded protocol buffers field, value holds varints and
+// fixed64 values, data length delimited ones.
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+func decodeProto(t *testing.T, data []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("invalid tag")
+		}
+		data = data[n:]
+		field := protoField{number: int(tag >> 3)}
+		switch tag & 0x7 {
+		case 0:
+			field.value, n = binary.Uvarint(data)
+			if n <= 0 {
+				t.Fatalf("invalid varint in field %d", field.number)
+			}
+			data = data[n:]
+		case 1:
+			field.value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || int(length) > len(data)-n {
+				t.Fatalf("invalid length in field %d", field.number)
+			}
+			field.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&0x7)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodePacked(t *testing.T, data []byte) []uint64 {
+	var values []uint64
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("invalid packed varint")
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values
+}
+
+type decodedFeature struct {
+	id         uint64
+	geomType   uint64
+	x, y       int64
+	properties map[string]interface{}
+}
+
+type decodedLayer struct {
+	name     string
+	version  uint64
+	extent   uint64
+	features []decodedFeature
+}
+
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func decodeTile(t *testing.T, data []byte) []decodedLayer {
+	t.Helper()
+	var layers []decodedLayer
+	for _, tileField := range decodeProto(t, data) {
+		if tileField.number != 3 {
+			t.Fatalf("unexpected tile field %d", tileField.number)
+		}
+		var layer decodedLayer
+		var keys []string
+		var values []interface{}
+		var features [][]protoField
+		for _, field := range decodeProto(t, tileField.data) {
+			switch field.number {
+			case 1:
+				layer.name = string(field.data)
+			case 2:
+				features = append(features, decodeProto(t, field.data))
+			case 3:
+				keys = append(keys, string(field.data))
+			case 4:
+				value := decodeProto(t, field.data)[0]
+				switch value.number {
+				case 1:
+					values = append(values, string(value.data))
+				case 3:
+					values = append(values, math.Float64frombits(value.value))
+				case 6:
+					values = append(values, unzigzag(value.value))
+				case 7:
+					values = append(values, value.value == 1)
+				default:
+					t.Fatalf("unexpected value type %d", value.number)
+				}
+			case 5:
+				layer.extent = field.value
+			case 15:
+				layer.version = field.value
+			}
+		}
+		for _, fields := range features {
+			feature := decodedFeature{properties: make(map[string]interface{})}
+			for _, field := range fields {
+				switch field.number {
+				case 1:
+					feature.id = field.value
+				case 2:
+					tags := decodePacked(t, field.data)
+					for i := 0; i+1 < len(tags); i += 2 {
+						feature.properties[keys[tags[i]]] = values[tags[i+1]]
+					}
+				case 3:
+					feature.geomType = field.value
+				case 4:
+					geometry := decodePacked(t, field.data)
+					if len(geometry) != 3 || geometry[0] != 1<<3|1 {
+						t.Fatalf("geometry %v is not a single MoveTo", geometry)
+					}
+					feature.x, feature.y = unzigzag(geometry[1]), unzigzag(geometry[2])
+				}
+			}
+			layer.features = append(layer.features, feature)
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func tileObservation(id string, longitude float64, latitude float64, temperature *float64, windSpeed *float64) Observation {
+	return Observation{Id: &id, Longitude: &longitude, Latitude: &latitude, TemperatureC: temperature, WindSpeedMs: windSpeed}
+}
+
+func TestEncodeObservationTile(t *testing.T) {
+	world := TileCoordinate{Z: 0, X: 0, Y: 0}
+	noClusters := TileOptions{ClusterMaxZoom: -1}
+	tests := []struct {
+		name         string
+		observations []Observation
+		tile         TileCoordinate
+		options      TileOptions
+		// want holds x, y and point_count, 0 when it is left out, per
+		// feature. A cluster is placed at the point with the most values.
+		want [][3]int64
+	}{
+		{"center", []Observation{tileObservation("a", 0, 0, floatPtr(-2.5), nil)}, world, noClusters, [][3]int64{{2048, 2048, 0}}},
+		{"east", []Observation{tileObservation("a", 90, 0, floatPtr(1), nil)}, world, noClusters, [][3]int64{{3072, 2048, 0}}},
+		{"within the buffer", []Observation{tileObservation("a", 0, 0, floatPtr(1), nil)}, TileCoordinate{Z: 1, X: 1, Y: 1}, noClusters, [][3]int64{{0, 0, 0}}},
+		{"outside the buffer", []Observation{tileObservation("a", -90, -45, floatPtr(1), nil)}, TileCoordinate{Z: 1, X: 1, Y: 1}, noClusters, nil},
+		{"clustered", []Observation{
+			tileObservation("a", 1, -1, floatPtr(1), nil),
+			tileObservation("b", 2, -2, floatPtr(2), floatPtr(3)),
+			tileObservation("c", 90, 0, floatPtr(4), nil),
+		}, world, DefaultTileOptions, [][3]int64{{2071, 2071, 2}, {3072, 2048, 1}}},
+		{"above the cluster zoom", []Observation{
+			tileObservation("a", 0, 0, floatPtr(1), nil),
+			tileObservation("b", 0.1, 0.1, floatPtr(2), nil),
+		}, TileCoordinate{Z: 10, X: 512, Y: 511}, DefaultTileOptions, [][3]int64{{0, 4096, 0}, {1165, 2931, 0}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layers := decodeTile(t, EncodeObservationTile(test.observations, test.tile, test.options))
+			if len(layers) != 1 {
+				t.Fatalf("got %d layers, want 1", len(layers))
+			}
+			layer := layers[0]
+			if layer.name != ObservationLayerName || layer.version != 2 || layer.extent != mvtExtent {
+				t.Errorf("layer %s version %d extent %d", layer.name, layer.version, layer.extent)
+			}
+			if len(layer.features) != len(test.want) {
+				t.Fatalf("got %d features, want %d", len(layer.features), len(test.want))
+			}
+			for i, feature := range layer.features {
+				want := test.want[i]
+				if feature.geomType != 1 || feature.id != uint64(i+1) {
+					t.Errorf("feature %d has type %d and id %d", i, feature.geomType, feature.id)
+				}
+				if feature.x != want[0] || feature.y != want[1] {
+					t.Errorf("feature %d at %d,%d, want %d,%d", i, feature.x, feature.y, want[0], want[1])
+				}
+				count, ok := feature.properties["point_count"]
+				if want[2] == 0 && ok {
+					t.Errorf("feature %d has point_count %v", i, count)
+				}
+				if want[2] != 0 && count != want[2] {
+					t.Errorf("feature %d point_count = %v, want %d", i, count, want[2])
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeObservationTileProperties(t *testing.T) {
+	observations := []Observation{
+		tileObservation("a", 0, 0, floatPtr(-2.5), nil),
+		tileObservation("b", 90, 0, floatPtr(-2.5), floatPtr(3)),
+	}
+	layers := decodeTile(t, EncodeObservationTile(observations, TileCoordinate{}, TileOptions{ClusterMaxZoom: -1}))
+	features := layers[0].features
+	if len(features) != 2 {
+		t.Fatalf("got %d features, want 2", len(features))
+	}
+	tests := []struct {
+		feature  int
+		property string
+		want     interface{}
+	}{
+		{0, "id", "a"},
+		{0, "temperature_c", -2.5},
+		{0, "windSpeed_ms", nil},
+		{1, "id", "b"},
+		{1, "temperature_c", -2.5},
+		{1, "windSpeed_ms", 3.0},
+	}
+	for _, test := range tests {
+		if got := features[test.feature].properties[test.property]; got != test.want {
+			t.Errorf("feature %d %s = %v, want %v", test.feature, test.property, got, test.want)
+		}
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  uint64
+	}{
+		{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2048, 4096}, {-256, 511},
+	}
+	for _, test := range tests {
+		if got := zigzag(test.value); got != test.want {
+			t.Errorf("zigzag(%d) = %d, want %d", test.value, got, test.want)
+		}
+		if got := unzigzag(test.want); got != test.value {
+			t.Errorf("unzigzag(%d) = %d, want %d", test.want, got, test.value)
+		}
+	}
+}
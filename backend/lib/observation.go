@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// ObservationSchemaVersion is written to every stored observation so readers
+// can tell documents from different versions of the model apart.
+const ObservationSchemaVersion = 2
+
+// QualityFlag describes how much a single value can be trusted.
+type QualityFlag string
+
+const (
+	// QualityGood values have been checked and approved by the source.
+	QualityGood QualityFlag = "good"
+	// QualitySuspect values have been flagged as suspicious or aggregated by the source.
+	QualitySuspect QualityFlag = "suspect"
+	// QualityUnverified values have not been checked by the source.
+	QualityUnverified QualityFlag = "unverified"
+)
+
+type Observation struct {
+	Id               *string  `json:"id"`
+	Name             *string  `json:"name"`
+	Latitude         *float64 `json:"latitude"`
+	Longitude        *float64 `json:"longitude"`
+	Elevation        *float64 `json:"elevation"`
+	TemperatureC     *float64 `json:"temperature_c"`
+	WindSpeedMs      *float64 `json:"windSpeed_ms"`
+	WindDirectionDeg *float64 `json:"windDirection_deg"`
+	WindGustSpeedMs  *float64 `json:"windGustSpeed_ms"`
+	HumidityPercent  *float64 `json:"humidity_percent"`
+	NewSnow24hCm     *float64 `json:"newSnow24h_cm"`
+	NewSnow72hCm     *float64 `json:"newSnow72h_cm"`
+	SnowDepthCm      *float64 `json:"snowDepth_cm"`
+	VisibilityM      *float64 `json:"visibility_m"`
+	// VisibilityScore is estimated from webcam images, from 0 in fog to 1 for
+	// a clear view, see MeasureImage.
+	VisibilityScore *float64 `json:"visibilityScore"`
+	// ObservedAt is when the source measured the values.
+	ObservedAt *time.Time `json:"observedAt"`
+	// FetchedAt is when the values were fetched from the source.
+	FetchedAt *time.Time `json:"fetchedAt"`
+	Source    *string    `json:"source"`
+	// Region is the name of the configured region the observation is in.
+	Region *string `json:"region"`
+	// Quality holds the quality of the values keyed by property name, e.g. "temperature_c".
+	Quality map[string]QualityFlag `json:"quality,omitempty"`
+}
+
+// SetQuality flags the quality of the value stored under the property name.
+func (observation *Observation) SetQuality(property string, flag QualityFlag) {
+	if observation.Quality == nil {
+		observation.Quality = make(map[string]QualityFlag)
+	}
+	observation.Quality[property] = flag
+}
+
+// MeasurementProperties lists the property names of the measured values.
+var MeasurementProperties = []string{
+	"temperature_c",
+	"windSpeed_ms",
+	"windDirection_deg",
+	"windGustSpeed_ms",
+	"humidity_percent",
+	"newSnow24h_cm",
+	"newSnow72h_cm",
+	"snowDepth_cm",
+	"visibility_m",
+	"visibilityScore",
+}
+
+// Value returns the measured value stored under the property name, or nil if
+// the source did not report it.
+func (observation Observation) Value(property string) *float64 {
+	switch property {
+	case "temperature_c":
+		return observation.TemperatureC
+	case "windSpeed_ms":
+		return observation.WindSpeedMs
+	case "windDirection_deg":
+		return observation.WindDirectionDeg
+	case "windGustSpeed_ms":
+		return observation.WindGustSpeedMs
+	case "humidity_percent":
+		return observation.HumidityPercent
+	case "newSnow24h_cm":
+		return observation.NewSnow24hCm
+	case "newSnow72h_cm":
+		return observation.NewSnow72hCm
+	case "snowDepth_cm":
+		return observation.SnowDepthCm
+	case "visibility_m":
+		return observation.VisibilityM
+	case "visibilityScore":
+		return observation.VisibilityScore
+	default:
+		return nil
+	}
+}
+
+func setProperty[T any](properties map[string]interface{}, key string, value *T) {
+	if value != nil {
+		properties[key] = *value
+	}
+}
+
+// ToFeature converts the observation into the GeoJSON point feature stored in
+// the weatherObservations collection. Values the source did not report are
+// left out rather than written as null. Stores replace the whole document, so
+// a value missing from the latest observation is removed.
+func (observation Observation) ToFeature() *geojson.Feature {
+	feature := geojson.NewPointFeature([]float64{*observation.Longitude, *observation.Latitude})
+	feature.ID = *observation.Id
+
+	properties := map[string]interface{}{
+		"schemaVersion": ObservationSchemaVersion,
+	}
+	setProperty(properties, "name", observation.Name)
+	setProperty(properties, "elevation", observation.Elevation)
+	setProperty(properties, "temperature_c", observation.TemperatureC)
+	setProperty(properties, "windSpeed_ms", observation.WindSpeedMs)
+	setProperty(properties, "windDirection_deg", observation.WindDirectionDeg)
+	setProperty(properties, "windGustSpeed_ms", observation.WindGustSpeedMs)
+	setProperty(properties, "humidity_percent", observation.HumidityPercent)
+	setProperty(properties, "newSnow24h_cm", observation.NewSnow24hCm)
+	setProperty(properties, "newSnow72h_cm", observation.NewSnow72hCm)
+	setProperty(properties, "snowDepth_cm", observation.SnowDepthCm)
+	setProperty(properties, "visibility_m", observation.VisibilityM)
+	setProperty(properties, "visibilityScore", observation.VisibilityScore)
+	setProperty(properties, "observedAt", observation.ObservedAt)
+	setProperty(properties, "fetchedAt", observation.FetchedAt)
+	setProperty(properties, "source", observation.Source)
+	setProperty(properties, "region", observation.Region)
+	if len(observation.Quality) > 0 {
+		properties["quality"] = observation.Quality
+	}
+	feature.Properties = properties
+	return feature
+}
+
+// ToMap converts the observation into a generic map holding its GeoJSON
+// feature, the shape Firestore documents are written in. Timestamps are kept
+// as time.Time so Firestore stores them as timestamps.
+func (observation Observation) ToMap() (map[string]interface{}, error) {
+	geoJsonBytes, err := observation.ToFeature().MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal feature: %w", err)
+	}
+
+	var geoJsonMap map[string]interface{}
+	if err := json.Unmarshal(geoJsonBytes, &geoJsonMap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON into map: %w", err)
+	}
+
+	properties := geoJsonMap["properties"].(map[string]interface{})
+	setProperty(properties, "observedAt", observation.ObservedAt)
+	setProperty(properties, "fetchedAt", observation.FetchedAt)
+	return geoJsonMap, nil
+}
+
+// ObservationFromFeature is the inverse of Observation.ToFeature.
+func ObservationFromFeature(feature *geojson.Feature) (Observation, error) {
+	var observation Observation
+
+	propertiesBytes, err := json.Marshal(feature.Properties)
+	if err != nil {
+		return observation, fmt.Errorf("failed to marshal properties: %w", err)
+	}
+	if err := json.Unmarshal(propertiesBytes, &observation); err != nil {
+		return observation, fmt.Errorf("failed to parse properties: %w", err)
+	}
+
+	id, ok := feature.ID.(string)
+	if !ok {
+		return observation, errors.New("feature.ID is not a string")
+	}
+	if feature.Geometry == nil || !feature.Geometry.IsPoint() || len(feature.Geometry.Point) < 2 {
+		return observation, fmt.Errorf("feature %s is not a point", id)
+	}
+	lon, lat := feature.Geometry.Point[0], feature.Geometry.Point[1]
+	observation.Id = &id
+	observation.Longitude = &lon
+	observation.Latitude = &lat
+	return observation, nil
+}
+
+// ObservationFromMap is the inverse of Observation.ToMap.
+func ObservationFromMap(data map[string]interface{}) (Observation, error) {
+	geoJsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return Observation{}, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	feature, err := geojson.UnmarshalFeature(geoJsonBytes)
+	if err != nil {
+		return Observation{}, fmt.Errorf("failed to parse feature: %w", err)
+	}
+	return ObservationFromFeature(feature)
+}
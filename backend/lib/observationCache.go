@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ObservationCache keeps the list of current observations of an instance for
+// a short time, so that the many tile requests of a map view share one read
+// of the store.
+type ObservationCache struct {
+	ttl time.Duration
+	// now is replaced in tests
+	now func() time.Time
+
+	mu           sync.Mutex
+	observations []Observation
+	loadedAt     time.Time
+}
+
+func NewObservationCache(ttl time.Duration) *ObservationCache {
+	return &ObservationCache{ttl: ttl, now: time.Now}
+}
+
+// List returns the cached observations, loading them again once they are
+// older than the TTL. Concurrent callers wait for a single load, failed loads
+// are not cached. The returned slice is shared and must not be modified.
+func (c *ObservationCache) List(ctx context.Context, load func(context.Context) ([]Observation, error)) ([]Observation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.observations != nil && c.now().Sub(c.loadedAt) < c.ttl {
+		return c.observations, nil
+	}
+	observations, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if observations == nil {
+		observations = []Observation{}
+	}
+	c.observations, c.loadedAt = observations, c.now()
+	return observations, nil
+}
+
+// Invalidate makes the next List load the observations, e.g. after an ingest.
+func (c *ObservationCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observations = nil
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObservationCache(t *testing.T) {
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewObservationCache(30 * time.Second)
+	cache.now = func() time.Time { return now }
+
+	loads := 0
+	var loadErr error
+	load := func(ctx context.Context) ([]Observation, error) {
+		loads++
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		id := "station"
+		return []Observation{{Id: &id}}, nil
+	}
+	steps := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		wantErr bool
+		loads   int
+	}{
+		{name: "first list loads", loads: 1},
+		{name: "within the ttl", advance: 29 * time.Second, loads: 1},
+		{name: "after the ttl", advance: 2 * time.Second, loads: 2},
+		{name: "failed load", advance: 31 * time.Second, fail: true, wantErr: true, loads: 3},
+		{name: "failure is not cached", loads: 4},
+		{name: "cached again", advance: time.Second, loads: 4},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		loadErr = nil
+		if step.fail {
+			loadErr = errors.New("unavailable")
+		}
+		observations, err := cache.List(context.Background(), load)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: err = %v", step.name, err)
+		}
+		if err == nil && len(observations) != 1 {
+			t.Errorf("%s: got %d observations", step.name, len(observations))
+		}
+		if loads != step.loads {
+			t.Errorf("%s: %d loads, want %d", step.name, loads, step.loads)
+		}
+	}
+
+	cache.Invalidate()
+	if _, err := cache.List(context.Background(), load); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 5 {
+		t.Errorf("invalidate: %d loads, want 5", loads)
+	}
+}
+
+func TestObservationCacheConcurrentLoads(t *testing.T) {
+	cache := NewObservationCache(time.Minute)
+	var mu sync.Mutex
+	loads := 0
+	load := func(ctx context.Context) ([]Observation, error) {
+		mu.Lock()
+		loads++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.List(context.Background(), load)
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("%d loads for concurrent requests, want 1", loads)
+	}
+}
@@ -0,0 +1,220 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// ObservationStore holds the latest observation per station.
+type ObservationStore interface {
+	// Put inserts or replaces the observations, keyed by their id.
+	Put(ctx context.Context, observations []Observation) error
+	List(ctx context.Context) ([]Observation, error)
+	Close() error
+}
+
+const (
+	StoreBackendFirestore = "firestore"
+	StoreBackendMemory    = "memory"
+	StoreBackendFile      = "file"
+)
+
+// StoreConfig selects where observations are kept. It is read from the
+// environment by LoadStoreConfig.
+type StoreConfig struct {
+	// Backend is one of StoreBackendFirestore, StoreBackendMemory or StoreBackendFile.
+	Backend string
+	// Dir is the data directory used by the file backend.
+	Dir string
+	// Collection is the Firestore collection holding the current observations.
+	Collection string
+	// ImageBackend is ImageBackendFirebase or ImageBackendLocal, the latter
+	// keeps the webcam images under Dir/images.
+	ImageBackend string
+	// ImageBaseURL is followed by the escaped key in the urls of local images.
+	ImageBaseURL string
+}
+
+// LoadStoreConfig reads STORE_BACKEND (default firestore), STORE_DIR (default
+// data) and OBSERVATION_COLLECTION (default weatherObservations). IMAGE_STORE
+// defaults to firebase with the firestore backend and local otherwise, local
+// images are served by the images function at IMAGE_BASE_URL.
+func LoadStoreConfig() StoreConfig {
+	backend := envOrDefault("STORE_BACKEND", StoreBackendFirestore)
+	imageBackend := ImageBackendLocal
+	if backend == StoreBackendFirestore {
+		imageBackend = ImageBackendFirebase
+	}
+	return StoreConfig{
+		Backend:      backend,
+		Dir:          envOrDefault("STORE_DIR", "data"),
+		Collection:   envOrDefault("OBSERVATION_COLLECTION", defaultObservationCollection),
+		ImageBackend: envOrDefault("IMAGE_STORE", imageBackend),
+		ImageBaseURL: envOrDefault("IMAGE_BASE_URL", "http://localhost:8080/images?key="),
+	}
+}
+
+var sharedMemoryObservationStore = NewMemoryObservationStore()
+
+// OpenObservationStore opens the store selected by the config. The memory
+// backend is shared by the whole process so that separate handlers see the
+// same data.
+func OpenObservationStore(ctx context.Context, config StoreConfig) (ObservationStore, error) {
+	switch config.Backend {
+	case StoreBackendFirestore:
+		return NewFirestoreObservationStore(ctx, config.Collection)
+	case StoreBackendMemory:
+		return sharedMemoryObservationStore, nil
+	case StoreBackendFile:
+		return NewFileObservationStore(filepath.Join(config.Dir, "observations.json")), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+	}
+}
+
+type MemoryObservationStore struct {
+	mu           sync.RWMutex
+	observations map[string]Observation
+}
+
+func NewMemoryObservationStore() *MemoryObservationStore {
+	return &MemoryObservationStore{observations: make(map[string]Observation)}
+}
+
+func (s *MemoryObservationStore) Put(ctx context.Context, observations []Observation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, observation := range observations {
+		s.observations[*observation.Id] = observation
+	}
+	return nil
+}
+
+func (s *MemoryObservationStore) List(ctx context.Context) ([]Observation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedObservations(s.observations), nil
+}
+
+func (s *MemoryObservationStore) Close() error {
+	return nil
+}
+
+// FileObservationStore keeps the observations as a GeoJSON FeatureCollection
+// in a single JSON file, handy for local development.
+type FileObservationStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileObservationStore(path string) *FileObservationStore {
+	return &FileObservationStore{path: path}
+}
+
+func (s *FileObservationStore) Put(ctx context.Context, observations []Observation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.read()
+	if err != nil {
+		return err
+	}
+	for _, observation := range observations {
+		existing[*observation.Id] = observation
+	}
+
+	collection := geojson.NewFeatureCollection()
+	for _, observation := range sortedObservations(existing) {
+		collection.AddFeature(observation.ToFeature())
+	}
+	data, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal observations: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+func (s *FileObservationStore) List(ctx context.Context) ([]Observation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	observations, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return sortedObservations(observations), nil
+}
+
+func (s *FileObservationStore) Close() error {
+	return nil
+}
+
+func (s *FileObservationStore) read() (map[string]Observation, error) {
+	observations := make(map[string]Observation)
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return observations, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	for _, feature := range collection.Features {
+		observation, err := ObservationFromFeature(feature)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+		}
+		observations[*observation.Id] = observation
+	}
+	return observations, nil
+}
+
+// writeFileAtomic writes through a temporary file so readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func sortedObservations(observations map[string]Observation) []Observation {
+	result := make([]Observation, 0, len(observations))
+	for _, observation := range observations {
+		result = append(result, observation)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return *result[i].Id < *result[j].Id
+	})
+	return result
+}
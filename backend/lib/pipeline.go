@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type IngestResult struct {
+	Provider string `json:"provider"`
+	Fetched  int    `json:"fetched"`
+	Rejected int    `json:"rejected"`
+	// Outside is the number of observations outside the active regions.
+	Outside int `json:"outside"`
+	Stored  int `json:"stored"`
+	// Appended is the number of new points in the history.
+	Appended int `json:"appended"`
+}
+
+// Ingest fetches observations from the provider, normalizes and validates them
+// and persists the valid ones as the current observations and in the history.
+// Observations are tagged with the region they are in, those outside all
+// regions are dropped.
+// When the provider fails partially, what it fetched is stored and its errors
+// are returned along with the result.
+func Ingest(ctx context.Context, provider ObservationProvider, stores *Stores, regions Regions) (IngestResult, error) {
+	result := IngestResult{Provider: provider.Name()}
+
+	fetchedAt := time.Now().UTC()
+	observations, fetchErr := provider.Fetch(ctx)
+	if fetchErr != nil {
+		if len(observations) == 0 {
+			return result, fmt.Errorf("error fetching observations from %s: %w", provider.Name(), fetchErr)
+		}
+		log.Printf("Partially fetched observations from %s: %v", provider.Name(), fetchErr)
+	}
+	result.Fetched = len(observations)
+
+	source := provider.Name()
+	for i := range observations {
+		observations[i].Source = &source
+		if observations[i].FetchedAt == nil {
+			observations[i].FetchedAt = &fetchedAt
+		}
+	}
+
+	valid := make([]Observation, 0, len(observations))
+	for _, observation := range observations {
+		normalizeObservation(&observation)
+		if err := ValidateObservation(observation); err != nil {
+			log.Printf("Rejected observation from %s: %v", provider.Name(), err)
+			result.Rejected++
+			continue
+		}
+		region, ok := regions.Locate(*observation.Longitude, *observation.Latitude)
+		if !ok {
+			result.Outside++
+			continue
+		}
+		observation.Region = &region
+		valid = append(valid, observation)
+	}
+
+	current := NormalizeObservations(valid)
+	if err := stores.Observations.Put(ctx, current); err != nil {
+		return result, errors.Join(fetchErr, fmt.Errorf("error storing observations from %s: %w", provider.Name(), err))
+	}
+	result.Stored = len(current)
+
+	// Values are only combined with values of the same time in the history,
+	// so a fallback value of an earlier hour keeps its own time
+	appended, err := stores.History.Append(ctx, mergeObservations(valid, observationTimeKey))
+	result.Appended = appended
+	if err != nil {
+		return result, errors.Join(fetchErr, fmt.Errorf("error appending history from %s: %w", provider.Name(), err))
+	}
+
+	log.Printf("Ingested %d of %d observations from %s", result.Stored, result.Fetched, provider.Name())
+	return result, fetchErr
+}
+
+// NormalizeObservations merges observations sharing the same id, drops
+// non-finite values and brings values into their canonical ranges.
+func NormalizeObservations(observations []Observation) []Observation {
+	merged := MergeObservations(observations)
+	for i := range merged {
+		normalizeObservation(&merged[i])
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return *merged[i].Id < *merged[j].Id
+	})
+	return merged
+}
+
+func normalizeObservation(observation *Observation) {
+	reflectObservation := reflect.ValueOf(observation).Elem()
+	for i := 0; i < reflectObservation.NumField(); i++ {
+		field := reflectObservation.Field(i)
+		if field.Type() != reflect.TypeOf((*float64)(nil)) || field.IsNil() {
+			continue
+		}
+		value := field.Elem().Float()
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	if observation.Name != nil {
+		name := strings.TrimSpace(*observation.Name)
+		observation.Name = &name
+	}
+	if observation.WindDirectionDeg != nil {
+		direction := math.Mod(*observation.WindDirectionDeg, 360)
+		if direction < 0 {
+			direction += 360
+		}
+		observation.WindDirectionDeg = &direction
+	}
+}
+
+func ValidateObservation(observation Observation) error {
+	if observation.Id == nil || *observation.Id == "" {
+		return errors.New("observation has no id")
+	}
+	if observation.Latitude == nil || observation.Longitude == nil {
+		return fmt.Errorf("observation %s has no position", *observation.Id)
+	}
+	if *observation.Latitude < -90 || *observation.Latitude > 90 || *observation.Longitude < -180 || *observation.Longitude > 180 {
+		return fmt.Errorf("observation %s has invalid position [%f, %f]", *observation.Id, *observation.Longitude, *observation.Latitude)
+	}
+	if observation.HumidityPercent != nil && (*observation.HumidityPercent < 0 || *observation.HumidityPercent > 100) {
+		return fmt.Errorf("observation %s has invalid humidity %f", *observation.Id, *observation.HumidityPercent)
+	}
+	if observation.VisibilityScore != nil && (*observation.VisibilityScore < 0 || *observation.VisibilityScore > 1) {
+		return fmt.Errorf("observation %s has invalid visibility score %f", *observation.Id, *observation.VisibilityScore)
+	}
+	return nil
+}
+
+// MergeObservations combines observations with the same id into one. Of each
+// field the value of the most recently observed observation wins, so
+// ObservedAt is the newest observation time, and the result does not depend
+// on the order of the observations. Quality flags are combined the same way.
+func MergeObservations(observations []Observation) []Observation {
+	return mergeObservations(observations, func(observation Observation) string {
+		return *observation.Id
+	})
+}
+
+// observationTimeKey groups the observations of a station by observation time.
+func observationTimeKey(observation Observation) string {
+	if observation.ObservedAt == nil {
+		return *observation.Id
+	}
+	return *observation.Id + "@" + historyKey(*observation.ObservedAt)
+}
+
+func mergeObservations(observations []Observation, key func(Observation) string) []Observation {
+	// Newest first, observations without a time last
+	sorted := make([]Observation, 0, len(observations))
+	for _, observation := range observations {
+		if observation.Id != nil {
+			sorted = append(sorted, observation)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].ObservedAt, sorted[j].ObservedAt
+		return a != nil && (b == nil || a.After(*b))
+	})
+
+	combinedObservations := make(map[string]Observation)
+	var order []string
+	for _, observation := range sorted {
+		observationKey := key(observation)
+		existingObservation, ok := combinedObservations[observationKey]
+		if !ok {
+			// The flags of the others are added, leave the caller's map alone
+			observation.Quality = maps.Clone(observation.Quality)
+			combinedObservations[observationKey] = observation
+			order = append(order, observationKey)
+			continue
+		}
+
+		reflectExisting := reflect.ValueOf(&existingObservation).Elem()
+		reflectObservation := reflect.ValueOf(observation)
+		for i := 0; i < reflectObservation.NumField(); i++ {
+			field := reflectObservation.Field(i)
+			targetField := reflectExisting.Field(i)
+			if targetField.Kind() == reflect.Ptr && targetField.IsNil() && !field.IsNil() {
+				targetField.Set(field)
+			}
+		}
+		for property, flag := range observation.Quality {
+			if _, exists := existingObservation.Quality[property]; !exists {
+				existingObservation.SetQuality(property, flag)
+			}
+		}
+		combinedObservations[observationKey] = existingObservation
+	}
+
+	combinedObservationsSlice := make([]Observation, 0, len(combinedObservations))
+	for _, id := range order {
+		combinedObservationsSlice = append(combinedObservationsSlice, combinedObservations[id])
+	}
+	return combinedObservationsSlice
+}
@@ -0,0 +1,303 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// permutations returns every order of the observations.
+func permutations(observations []Observation) [][]Observation {
+	if len(observations) <= 1 {
+		return [][]Observation{observations}
+	}
+	var result [][]Observation
+	for i := range observations {
+		rest := append(append([]Observation(nil), observations[:i]...), observations[i+1:]...)
+		for _, permutation := range permutations(rest) {
+			result = append(result, append([]Observation{observations[i]}, permutation...))
+		}
+	}
+	return result
+}
+
+func TestMergeObservations(t *testing.T) {
+	hour := func(hour int) time.Time {
+		return time.Date(2024, 12, 1, hour, 0, 0, 0, time.UTC)
+	}
+	latestHour := testObservation("smhi-1", hour(12), floatPtr(-4), nil)
+	latestHour.SetQuality("temperature_c", QualityGood)
+	fallbackTemperature := testObservation("smhi-1", hour(11), floatPtr(-2), nil)
+	fallbackTemperature.SetQuality("temperature_c", QualitySuspect)
+	snow := testObservation("smhi-1", hour(6), nil, nil)
+	snow.SnowDepthCm = floatPtr(80)
+	snow.SetQuality("snowDepth_cm", QualityGood)
+	wind := testObservation("smhi-1", hour(12), nil, floatPtr(5))
+	observations := []Observation{latestHour, fallbackTemperature, snow, wind}
+
+	for _, permutation := range permutations(observations) {
+		merged := MergeObservations(permutation)
+		if len(merged) != 1 {
+			t.Fatalf("got %d observations, want 1", len(merged))
+		}
+		observation := merged[0]
+		if !observation.ObservedAt.Equal(hour(12)) {
+			t.Errorf("observed at %v, want the newest %v", observation.ObservedAt, hour(12))
+		}
+		if *observation.TemperatureC != -4 || observation.Quality["temperature_c"] != QualityGood {
+			t.Errorf("temperature %v %s, want the newest -4 good", *observation.TemperatureC, observation.Quality["temperature_c"])
+		}
+		if observation.SnowDepthCm == nil || *observation.SnowDepthCm != 80 || observation.WindSpeedMs == nil || *observation.WindSpeedMs != 5 {
+			t.Errorf("snow depth %v and wind speed %v, want 80 and 5", observation.SnowDepthCm, observation.WindSpeedMs)
+		}
+
+		points := mergeObservations(permutation, observationTimeKey)
+		if len(points) != 3 {
+			t.Fatalf("got %d history points, want one per observation time", len(points))
+		}
+		for _, point := range points {
+			switch {
+			case point.ObservedAt.Equal(hour(12)):
+				if *point.TemperatureC != -4 || point.WindSpeedMs == nil || point.SnowDepthCm != nil {
+					t.Errorf("the 12:00 point has the values of other times: %+v", point)
+				}
+			case point.ObservedAt.Equal(hour(11)):
+				if *point.TemperatureC != -2 || point.Quality["temperature_c"] != QualitySuspect {
+					t.Errorf("the 11:00 point lost its temperature")
+				}
+			case point.ObservedAt.Equal(hour(6)):
+				if point.TemperatureC != nil || *point.SnowDepthCm != 80 {
+					t.Errorf("the 06:00 point has the values of other times")
+				}
+			}
+		}
+	}
+	if len(latestHour.Quality) != 1 || len(snow.Quality) != 1 {
+		t.Error("merging changed the quality flags of its input")
+	}
+}
+
+type stubProvider struct {
+	observations []Observation
+	err          error
+}
+
+func (stubProvider) Name() string {
+	return "stub"
+}
+
+func (provider stubProvider) Fetch(ctx context.Context) ([]Observation, error) {
+	return provider.observations, provider.err
+}
+
+// recordingStores wraps memory stores and records what is put and appended.
+type recordingStores struct {
+	ObservationStore
+	ObservationHistoryStore
+	puts    [][]Observation
+	appends [][]Observation
+}
+
+func (stores *recordingStores) Put(ctx context.Context, observations []Observation) error {
+	stores.puts = append(stores.puts, observations)
+	return stores.ObservationStore.Put(ctx, observations)
+}
+
+func (stores *recordingStores) Append(ctx context.Context, observations []Observation) (int, error) {
+	stores.appends = append(stores.appends, observations)
+	return stores.ObservationHistoryStore.Append(ctx, observations)
+}
+
+func (stores *recordingStores) Close() error {
+	return nil
+}
+
+func TestIngest(t *testing.T) {
+	hour := func(hour int) time.Time {
+		return time.Date(2024, 12, 1, hour, 0, 0, 0, time.UTC)
+	}
+	square := func(longitude float64, latitude float64) MultiPolygon {
+		return MultiPolygon{{{{longitude, latitude}, {longitude + 1, latitude}, {longitude + 1, latitude + 1}, {longitude, latitude + 1}, {longitude, latitude}}}}
+	}
+	regions := Regions{{Name: "jamtland", Area: square(12.5, 63)}, {Name: "dalarna", Area: square(13, 61)}}
+	at := func(observation Observation, longitude float64, latitude float64) Observation {
+		observation.Longitude, observation.Latitude = &longitude, &latitude
+		return observation
+	}
+	unavailable := errors.New("unavailable")
+
+	tests := []struct {
+		name         string
+		observations []Observation
+		err          error
+		want         IngestResult
+		wantErr      error
+		stored       map[string]string // id to region
+		appended     int
+	}{
+		{
+			name: "merged by id",
+			observations: []Observation{
+				testObservation("a", hour(12), floatPtr(-4), nil),
+				testObservation("a", hour(12), nil, floatPtr(3)),
+				at(testObservation("b", hour(12), floatPtr(1), nil), 13.5, 61.5),
+			},
+			want:     IngestResult{Fetched: 3, Stored: 2, Appended: 2},
+			stored:   map[string]string{"a": "jamtland", "b": "dalarna"},
+			appended: 2,
+		},
+		{
+			name: "invalid and outside dropped",
+			observations: []Observation{
+				testObservation("a", hour(12), floatPtr(-4), nil),
+				testObservation("", hour(12), floatPtr(-4), nil),
+				func() Observation {
+					observation := testObservation("humid", hour(12), nil, nil)
+					observation.HumidityPercent = floatPtr(120)
+					return observation
+				}(),
+				at(testObservation("abisko", hour(12), floatPtr(-12), nil), 18.8, 68.4),
+			},
+			want:     IngestResult{Fetched: 4, Rejected: 2, Outside: 1, Stored: 1, Appended: 1},
+			stored:   map[string]string{"a": "jamtland"},
+			appended: 1,
+		},
+		{
+			name: "fallback of an earlier hour",
+			observations: []Observation{
+				testObservation("a", hour(12), nil, floatPtr(3)),
+				testObservation("a", hour(11), floatPtr(-2), nil),
+			},
+			want:     IngestResult{Fetched: 2, Stored: 1, Appended: 2},
+			stored:   map[string]string{"a": "jamtland"},
+			appended: 2,
+		},
+		{
+			name:    "failed fetch",
+			err:     unavailable,
+			wantErr: unavailable,
+		},
+		{
+			name:         "partial fetch",
+			observations: []Observation{testObservation("a", hour(12), floatPtr(-4), nil)},
+			err:          &FetchError{Item: "b", Err: unavailable},
+			want:         IngestResult{Fetched: 1, Stored: 1, Appended: 1},
+			wantErr:      unavailable,
+			stored:       map[string]string{"a": "jamtland"},
+			appended:     1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			recording := &recordingStores{ObservationStore: NewMemoryObservationStore(), ObservationHistoryStore: NewMemoryHistoryStore()}
+			stores := &Stores{Observations: recording, History: recording, Contours: NewMemoryContourStore()}
+
+			result, err := Ingest(ctx, stubProvider{observations: test.observations, err: test.err}, stores, regions)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			test.want.Provider = "stub"
+			if result != test.want {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+
+			if test.stored == nil {
+				if len(recording.puts) != 0 || len(recording.appends) != 0 {
+					t.Errorf("stored %d and appended %d times after a failed fetch", len(recording.puts), len(recording.appends))
+				}
+				return
+			}
+			if len(recording.puts) != 1 || len(recording.appends) != 1 {
+				t.Fatalf("put %d and appended %d times, want once each", len(recording.puts), len(recording.appends))
+			}
+			if len(recording.appends[0]) != test.appended {
+				t.Errorf("appended %d history points, want %d", len(recording.appends[0]), test.appended)
+			}
+			stored, err := recording.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != len(test.stored) {
+				t.Errorf("stored %d observations, want %d", len(stored), len(test.stored))
+			}
+			for _, observation := range stored {
+				if observation.Region == nil || *observation.Region != test.stored[*observation.Id] {
+					t.Errorf("%s is in region %v, want %s", *observation.Id, observation.Region, test.stored[*observation.Id])
+				}
+				if observation.Source == nil || *observation.Source != "stub" || observation.FetchedAt == nil {
+					t.Errorf("%s lacks its source or fetch time", *observation.Id)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateObservation(t *testing.T) {
+	valid := testObservation("a", time.Now(), floatPtr(-4), nil)
+	tests := []struct {
+		name    string
+		modify  func(*Observation)
+		wantErr bool
+	}{
+		{"valid", func(*Observation) {}, false},
+		{"no id", func(observation *Observation) { observation.Id = nil }, true},
+		{"empty id", func(observation *Observation) { observation.Id = new(string) }, true},
+		{"no position", func(observation *Observation) { observation.Latitude = nil }, true},
+		{"invalid latitude", func(observation *Observation) { observation.Latitude = floatPtr(91) }, true},
+		{"invalid longitude", func(observation *Observation) { observation.Longitude = floatPtr(-181) }, true},
+		{"humidity above 100", func(observation *Observation) { observation.HumidityPercent = floatPtr(101) }, true},
+		{"humidity of 100", func(observation *Observation) { observation.HumidityPercent = floatPtr(100) }, false},
+		{"negative visibility score", func(observation *Observation) { observation.VisibilityScore = floatPtr(-0.1) }, true},
+		{"no values", func(observation *Observation) { observation.TemperatureC = nil }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			observation := valid
+			test.modify(&observation)
+			if err := ValidateObservation(observation); (err != nil) != test.wantErr {
+				t.Errorf("got %v, want an error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeObservations(t *testing.T) {
+	observedAt := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		direction float64
+		want      *float64
+	}{
+		{"in range", 270, floatPtr(270)},
+		{"negative", -30, floatPtr(330)},
+		{"full turn", 720, floatPtr(0)},
+		{"not a number", math.NaN(), nil},
+		{"infinite", math.Inf(1), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := "  Åre  "
+			observation := testObservation("b", observedAt, floatPtr(-4), nil)
+			observation.Name = &name
+			observation.WindDirectionDeg = floatPtr(test.direction)
+			normalized := NormalizeObservations([]Observation{observation, testObservation("a", observedAt, nil, floatPtr(2))})
+
+			if len(normalized) != 2 || *normalized[0].Id != "a" || *normalized[1].Id != "b" {
+				t.Fatalf("got %d observations, want a and b sorted by id", len(normalized))
+			}
+			direction := normalized[1].WindDirectionDeg
+			if (direction == nil) != (test.want == nil) || (direction != nil && *direction != *test.want) {
+				t.Errorf("direction %v, want %v", direction, test.want)
+			}
+			if *normalized[1].Name != "Åre" {
+				t.Errorf("name %q is not trimmed", *normalized[1].Name)
+			}
+			if *normalized[1].TemperatureC != -4 {
+				t.Errorf("temperature %v, want the other values kept", *normalized[1].TemperatureC)
+			}
+		})
+	}
+}
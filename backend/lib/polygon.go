@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// Polygon is a list of rings of [longitude, latitude] points, the first ring
+// is the outline and the others are holes. Rings are closed, the last point
+// repeats the first.
+type Polygon [][][]float64
+
+// MultiPolygon is an area of one or more separate polygons, e.g. the outlines
+// of a mountain range.
+type MultiPolygon []Polygon
+
+// MultiPolygonFromGeometry reads a GeoJSON Polygon or MultiPolygon, closing
+// rings that are left open.
+func MultiPolygonFromGeometry(geometry *geojson.Geometry) (MultiPolygon, error) {
+	if geometry == nil {
+		return nil, errors.New("geometry is required")
+	}
+	var polygons [][][][]float64
+	switch geometry.Type {
+	case geojson.GeometryPolygon:
+		polygons = [][][][]float64{geometry.Polygon}
+	case geojson.GeometryMultiPolygon:
+		polygons = geometry.MultiPolygon
+	default:
+		return nil, fmt.Errorf("geometry must be a Polygon or MultiPolygon, got %s", geometry.Type)
+	}
+	if len(polygons) == 0 {
+		return nil, errors.New("geometry has no polygons")
+	}
+
+	area := make(MultiPolygon, 0, len(polygons))
+	for i, rings := range polygons {
+		if len(rings) == 0 {
+			return nil, fmt.Errorf("polygon %d has no rings", i)
+		}
+		polygon := make(Polygon, 0, len(rings))
+		for j, ring := range rings {
+			for _, point := range ring {
+				if len(point) < 2 || point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+					return nil, fmt.Errorf("polygon %d ring %d has an invalid [longitude, latitude] %v", i, j, point)
+				}
+			}
+			if len(ring) > 0 && (ring[0][0] != ring[len(ring)-1][0] || ring[0][1] != ring[len(ring)-1][1]) {
+				ring = append(ring, ring[0])
+			}
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("polygon %d ring %d must have at least 3 points", i, j)
+			}
+			polygon = append(polygon, ring)
+		}
+		area = append(area, polygon)
+	}
+	return area, nil
+}
+
+// Contains tests whether the coordinate is inside the outline and not in a hole.
+func (polygon Polygon) Contains(longitude float64, latitude float64) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], longitude, latitude) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, longitude, latitude) {
+			return false
+		}
+	}
+	return true
+}
+
+func (area MultiPolygon) Contains(longitude float64, latitude float64) bool {
+	for _, polygon := range area {
+		if polygon.Contains(longitude, latitude) {
+			return true
+		}
+	}
+	return false
+}
+
+func (area MultiPolygon) BoundingBox() BoundingBox {
+	box := BoundingBox{MinLongitude: math.Inf(1), MinLatitude: math.Inf(1), MaxLongitude: math.Inf(-1), MaxLatitude: math.Inf(-1)}
+	for _, polygon := range area {
+		for _, point := range polygon[0] {
+			box.MinLongitude = min(box.MinLongitude, point[0])
+			box.MinLatitude = min(box.MinLatitude, point[1])
+			box.MaxLongitude = max(box.MaxLongitude, point[0])
+			box.MaxLatitude = max(box.MaxLatitude, point[1])
+		}
+	}
+	return box
+}
+
+// ringContains casts a ray towards the east and counts the edges it crosses.
+func ringContains(ring [][]float64, longitude float64, latitude float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > latitude) != (b[1] > latitude) &&
+			longitude < (b[0]-a[0])*(latitude-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+func TestPolygonContains(t *testing.T) {
+	// A 10x10 square with a 2x2 hole in the middle and a concave notch cut
+	// into its east side
+	outline := [][]float64{{0, 0}, {10, 0}, {10, 4}, {6, 5}, {10, 6}, {10, 10}, {0, 10}, {0, 0}}
+	hole := [][]float64{{4, 4}, {4, 6}, {2, 6}, {2, 4}, {4, 4}}
+	polygon := Polygon{outline, hole}
+	tests := []struct {
+		name      string
+		longitude float64
+		latitude  float64
+		want      bool
+	}{
+		{"inside", 1, 1, true},
+		{"between hole and notch", 5, 5, true},
+		{"in the hole", 3, 5, false},
+		{"in the notch", 8, 5, false},
+		{"north of the notch", 8, 7, true},
+		{"west", -1, 5, false},
+		{"east", 11, 5, false},
+		{"north", 5, 11, false},
+		{"level with a vertex", 1, 4, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := polygon.Contains(test.longitude, test.latitude); got != test.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", test.longitude, test.latitude, got, test.want)
+			}
+		})
+	}
+
+	if (Polygon{}).Contains(1, 1) {
+		t.Error("an empty polygon contains nothing")
+	}
+}
+
+func TestMultiPolygonFromGeometry(t *testing.T) {
+	square := func(x float64) [][]float64 {
+		return [][]float64{{x, 0}, {x + 1, 0}, {x + 1, 1}, {x, 1}}
+	}
+	tests := []struct {
+		name     string
+		geometry *geojson.Geometry
+		polygons int
+		inside   [][2]float64
+		wantErr  bool
+	}{
+		{"open ring is closed", geojson.NewPolygonGeometry([][][]float64{square(0)}), 1, [][2]float64{{0.5, 0.5}}, false},
+		{"multipolygon", geojson.NewMultiPolygonGeometry([][][]float64{square(0)}, [][][]float64{square(5)}), 2, [][2]float64{{0.5, 0.5}, {5.5, 0.5}}, false},
+		{"missing geometry", nil, 0, nil, true},
+		{"point", geojson.NewPointGeometry([]float64{1, 1}), 0, nil, true},
+		{"too few points", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 1}}}), 0, nil, true},
+		{"invalid latitude", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 0}, {1, 91}}}), 0, nil, true},
+		{"no rings", geojson.NewPolygonGeometry([][][]float64{}), 0, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			area, err := MultiPolygonFromGeometry(test.geometry)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(area) != test.polygons {
+				t.Fatalf("got %d polygons, want %d", len(area), test.polygons)
+			}
+			for _, polygon := range area {
+				first, last := polygon[0][0], polygon[0][len(polygon[0])-1]
+				if first[0] != last[0] || first[1] != last[1] {
+					t.Errorf("ring %v is not closed", polygon[0])
+				}
+			}
+			for _, point := range test.inside {
+				if !area.Contains(point[0], point[1]) {
+					t.Errorf("%v is not inside", point)
+				}
+			}
+			if area.Contains(3, 0.5) {
+				t.Error("the gap between the polygons is inside")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ObservationProvider fetches the current observations from one weather source.
+// Adding a new source only requires implementing this interface and registering
+// it, the ingestion pipeline takes care of the rest.
+//
+// Fetch may return observations together with an error when only some items of
+// the source failed, preferably joined FetchErrors. The observations are then
+// stored and the errors reported.
+type ObservationProvider interface {
+	Name() string
+	Fetch(ctx context.Context) ([]Observation, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ObservationProvider)
+)
+
+// RegisterProvider makes a provider available by name. It panics if a provider
+// with the same name is already registered, as that is a programming error.
+func RegisterProvider(provider ObservationProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	name := provider.Name()
+	if _, exists := providers[name]; exists {
+		panic(fmt.Sprintf("observation provider %q registered twice", name))
+	}
+	providers[name] = provider
+}
+
+func GetProvider(name string) (ObservationProvider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// Providers returns all registered providers sorted by name.
+func Providers() []ObservationProvider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	result := make([]ObservationProvider, 0, len(providers))
+	for _, provider := range providers {
+		result = append(result, provider)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result
+}
@@ -0,0 +1,50 @@
+package lib
+
+import "math"
+
+// Region is a named area observations are fetched for.
+type Region struct {
+	Name string
+	Area MultiPolygon
+}
+
+func (region Region) BoundingBox() BoundingBox {
+	return region.Area.BoundingBox()
+}
+
+func (region Region) Contains(longitude float64, latitude float64) bool {
+	return region.Area.Contains(longitude, latitude)
+}
+
+type Regions []Region
+
+// Locate returns the name of the first region containing the coordinate.
+func (regions Regions) Locate(longitude float64, latitude float64) (string, bool) {
+	for _, region := range regions {
+		if region.Contains(longitude, latitude) {
+			return region.Name, true
+		}
+	}
+	return "", false
+}
+
+// BoundingBox is the smallest box containing all regions.
+func (regions Regions) BoundingBox() BoundingBox {
+	box := BoundingBox{MinLongitude: math.Inf(1), MinLatitude: math.Inf(1), MaxLongitude: math.Inf(-1), MaxLatitude: math.Inf(-1)}
+	for _, region := range regions {
+		regionBox := region.BoundingBox()
+		box.MinLongitude = min(box.MinLongitude, regionBox.MinLongitude)
+		box.MinLatitude = min(box.MinLatitude, regionBox.MinLatitude)
+		box.MaxLongitude = max(box.MaxLongitude, regionBox.MaxLongitude)
+		box.MaxLatitude = max(box.MaxLatitude, regionBox.MaxLatitude)
+	}
+	return box
+}
+
+func (regions Regions) Names() []string {
+	names := make([]string, len(regions))
+	for i, region := range regions {
+		names[i] = region.Name
+	}
+	return names
+}
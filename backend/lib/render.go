@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const TileSize = 256
+
+type ColorStop struct {
+	Value float64
+	Color color.NRGBA
+}
+
+// ColorRamp maps values to colors by linear interpolation between the stops,
+// which must be sorted by value. Values outside the stops get the color of
+// the nearest stop.
+type ColorRamp []ColorStop
+
+func (ramp ColorRamp) At(value float64) color.NRGBA {
+	if value <= ramp[0].Value {
+		return ramp[0].Color
+	}
+	for i := 1; i < len(ramp); i++ {
+		if value > ramp[i].Value {
+			continue
+		}
+		previous, next := ramp[i-1], ramp[i]
+		t := (value - previous.Value) / (next.Value - previous.Value)
+		mix := func(a uint8, b uint8) uint8 {
+			return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+		}
+		return color.NRGBA{
+			R: mix(previous.Color.R, next.Color.R),
+			G: mix(previous.Color.G, next.Color.G),
+			B: mix(previous.Color.B, next.Color.B),
+			A: mix(previous.Color.A, next.Color.A),
+		}
+	}
+	return ramp[len(ramp)-1].Color
+}
+
+var TemperatureRamp = ColorRamp{
+	{-30, color.NRGBA{R: 94, G: 40, B: 153, A: 170}},
+	{-15, color.NRGBA{R: 49, G: 54, B: 149, A: 170}},
+	{-5, color.NRGBA{R: 116, G: 173, B: 209, A: 170}},
+	{0, color.NRGBA{R: 224, G: 243, B: 248, A: 170}},
+	{5, color.NRGBA{R: 254, G: 224, B: 144, A: 170}},
+	{15, color.NRGBA{R: 244, G: 109, B: 67, A: 170}},
+	{25, color.NRGBA{R: 165, G: 0, B: 38, A: 170}},
+}
+
+var WindSpeedRamp = ColorRamp{
+	{0, color.NRGBA{R: 255, G: 255, B: 255, A: 0}},
+	{3, color.NRGBA{R: 199, G: 233, B: 180, A: 150}},
+	{8, color.NRGBA{R: 65, G: 182, B: 196, A: 170}},
+	{14, color.NRGBA{R: 254, G: 217, B: 118, A: 180}},
+	{20, color.NRGBA{R: 253, G: 141, B: 60, A: 190}},
+	{30, color.NRGBA{R: 189, G: 0, B: 38, A: 200}},
+}
+
+var SnowDepthRamp = ColorRamp{
+	{0, color.NRGBA{R: 255, G: 255, B: 255, A: 0}},
+	{5, color.NRGBA{R: 222, G: 235, B: 247, A: 120}},
+	{30, color.NRGBA{R: 158, G: 202, B: 225, A: 160}},
+	{75, color.NRGBA{R: 66, G: 146, B: 198, A: 180}},
+	{150, color.NRGBA{R: 8, G: 69, B: 148, A: 190}},
+	{250, color.NRGBA{R: 84, G: 39, B: 143, A: 200}},
+}
+
+// RenderTile colors every pixel of the tile by sampling the grid at the pixel
+// center. Pixels without an estimate are transparent.
+func RenderTile(grid *Grid, tile TileCoordinate, ramp ColorRamp) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	for y := 0; y < TileSize; y++ {
+		// Latitude only depends on the row
+		_, latitude := tile.Unproject(0, (float64(y)+0.5)/TileSize)
+		for x := 0; x < TileSize; x++ {
+			longitude, _ := tile.Unproject((float64(x)+0.5)/TileSize, 0)
+			value := grid.At(longitude, latitude)
+			if math.IsNaN(value) {
+				continue
+			}
+			img.SetNRGBA(x, y, ramp.At(value))
+		}
+	}
+	return img
+}
+
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buffer, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
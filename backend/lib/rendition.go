@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// Rendition is a downscaled copy of webcam images, the original is the "full"
+// rendition.
+type Rendition struct {
+	Name  string
+	Width int
+}
+
+const FullRendition = "full"
+
+var WebcamRenditions = []Rendition{
+	{Name: "thumb", Width: 320},
+	{Name: "medium", Width: 960},
+}
+
+const renditionJpegQuality = 80
+
+// RenditionKey is where a rendition of the latest image of a webcam is stored.
+func RenditionKey(name string, rendition string) string {
+	return fmt.Sprintf("renditions/%s/%s.jpg", name, rendition)
+}
+
+// RenderRenditions encodes every rendition narrower than the image as JPEG,
+// keyed by rendition name.
+func RenderRenditions(img image.Image) (map[string][]byte, error) {
+	renditions := make(map[string][]byte)
+	for _, rendition := range WebcamRenditions {
+		if img.Bounds().Dx() <= rendition.Width {
+			continue
+		}
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, ResizeToWidth(img, rendition.Width), &jpeg.Options{Quality: renditionJpegQuality}); err != nil {
+			return nil, fmt.Errorf("error encoding %s rendition: %w", rendition.Name, err)
+		}
+		renditions[rendition.Name] = buffer.Bytes()
+	}
+	return renditions, nil
+}
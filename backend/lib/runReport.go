@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusPartial = "partial"
+	StatusFailed  = "failed"
+)
+
+// FetchError is the failure of one item of a source, e.g. a station or a
+// webcam. The other items of the source can still succeed.
+type FetchError struct {
+	Item string
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Item, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+type ItemError struct {
+	Item  string `json:"item,omitempty"`
+	Error string `json:"error"`
+}
+
+// ItemErrors flattens joined errors into one entry per error, with the item of
+// every FetchError. Wrapped item errors are unwrapped, the source they are
+// reported under already gives the context of the wrapping message.
+func ItemErrors(err error) []ItemError {
+	if err == nil {
+		return nil
+	}
+	switch err := err.(type) {
+	case *FetchError:
+		return []ItemError{{Item: err.Item, Error: err.Err.Error()}}
+	case interface{ Unwrap() []error }:
+		var result []ItemError
+		for _, err := range err.Unwrap() {
+			result = append(result, ItemErrors(err)...)
+		}
+		return result
+	case interface{ Unwrap() error }:
+		inner := ItemErrors(err.Unwrap())
+		if len(inner) > 1 || (len(inner) == 1 && inner[0].Item != "") {
+			return inner
+		}
+	}
+	return []ItemError{{Error: err.Error()}}
+}
+
+// SourceReport is the outcome of one source in a run.
+type SourceReport struct {
+	Source    string      `json:"source"`
+	Status    string      `json:"status"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Errors    []ItemError `json:"errors,omitempty"`
+	// Ingest is set for observation providers.
+	Ingest *IngestResult `json:"ingest,omitempty"`
+}
+
+// RunReport lists the successes and failures of every source of a run, a
+// failing source does not stop the others.
+type RunReport struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Status     string         `json:"status"`
+	Sources    []SourceReport `json:"sources"`
+	// Breakers are the upstream hosts contacted by this instance.
+	Breakers []BreakerState `json:"breakers"`
+}
+
+func NewRunReport() *RunReport {
+	return &RunReport{StartedAt: time.Now().UTC(), Sources: []SourceReport{}}
+}
+
+// Add records a source where succeeded items went through and err holds the
+// failures, if any. The source is partial when both are present.
+func (report *RunReport) Add(source string, succeeded int, err error) *SourceReport {
+	sourceReport := SourceReport{Source: source, Status: StatusOK, Succeeded: succeeded, Errors: ItemErrors(err)}
+	sourceReport.Failed = len(sourceReport.Errors)
+	if err != nil {
+		sourceReport.Status = StatusFailed
+		if succeeded > 0 {
+			sourceReport.Status = StatusPartial
+		}
+	}
+	report.Sources = append(report.Sources, sourceReport)
+	return &report.Sources[len(report.Sources)-1]
+}
+
+// AddIngest records the result of ingesting an observation provider.
+func (report *RunReport) AddIngest(result IngestResult, err error) {
+	sourceReport := report.Add(result.Provider, result.Stored, err)
+	sourceReport.Ingest = &result
+}
+
+// Finish sets the overall status, failed only when every source failed, and
+// the state of the circuit breakers.
+func (report *RunReport) Finish() {
+	report.FinishedAt = time.Now().UTC()
+	report.Breakers = HostBreakers.States()
+	report.Status = StatusOK
+	failed := 0
+	for _, source := range report.Sources {
+		if source.Status != StatusOK {
+			report.Status = StatusPartial
+		}
+		if source.Status == StatusFailed {
+			failed++
+		}
+	}
+	if len(report.Sources) > 0 && failed == len(report.Sources) {
+		report.Status = StatusFailed
+	}
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRunReportAdd(t *testing.T) {
+	stationErrors := errors.Join(
+		&FetchError{Item: "station 1", Err: errors.New("timeout")},
+		&FetchError{Item: "station 2", Err: errors.New("bad gateway")},
+	)
+	tests := []struct {
+		name      string
+		succeeded int
+		err       error
+		status    string
+		failed    int
+	}{
+		{"ok", 3, nil, StatusOK, 0},
+		{"nothing to do", 0, nil, StatusOK, 0},
+		{"partial", 3, stationErrors, StatusPartial, 2},
+		{"failed items", 0, stationErrors, StatusFailed, 2},
+		{"failed source", 0, errors.New("unavailable"), StatusFailed, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewRunReport()
+			source := report.Add("smhi", test.succeeded, test.err)
+			if source.Status != test.status || source.Failed != test.failed || source.Succeeded != test.succeeded {
+				t.Errorf("got %s with %d succeeded and %d failed, want %s with %d and %d", source.Status, source.Succeeded, source.Failed, test.status, test.succeeded, test.failed)
+			}
+			if len(report.Sources) != 1 || report.Sources[0].Status != test.status {
+				t.Errorf("sources = %+v", report.Sources)
+			}
+		})
+	}
+}
+
+func TestRunReportFinish(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     string
+	}{
+		{"no sources", nil, StatusOK},
+		{"all ok", []string{StatusOK, StatusOK}, StatusOK},
+		{"one partial", []string{StatusOK, StatusPartial}, StatusPartial},
+		{"one failed", []string{StatusFailed, StatusOK}, StatusPartial},
+		{"partial and failed", []string{StatusFailed, StatusPartial}, StatusPartial},
+		{"all failed", []string{StatusFailed, StatusFailed}, StatusFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewRunReport()
+			for i, status := range test.statuses {
+				report.Sources = append(report.Sources, SourceReport{Source: fmt.Sprint(i), Status: status})
+			}
+			report.Finish()
+			if report.Status != test.want {
+				t.Errorf("status = %s, want %s", report.Status, test.want)
+			}
+			if report.FinishedAt.Before(report.StartedAt) {
+				t.Errorf("finished at %v before starting at %v", report.FinishedAt, report.StartedAt)
+			}
+		})
+	}
+}
+
+func TestRunReportAddIngest(t *testing.T) {
+	report := NewRunReport()
+	result := IngestResult{Provider: "trafikverket", Fetched: 5, Rejected: 1, Stored: 4}
+	report.AddIngest(result, &FetchError{Item: "station 9", Err: errors.New("no data")})
+	source := report.Sources[0]
+	if source.Source != "trafikverket" || source.Status != StatusPartial || source.Succeeded != 4 {
+		t.Errorf("source = %+v", source)
+	}
+	if source.Ingest == nil || *source.Ingest != result {
+		t.Errorf("ingest = %+v, want %+v", source.Ingest, result)
+	}
+}
+
+func TestItemErrors(t *testing.T) {
+	timeout := errors.New("timeout")
+	tests := []struct {
+		name string
+		err  error
+		want []ItemError
+	}{
+		{"nil", nil, nil},
+		{"plain", timeout, []ItemError{{Error: "timeout"}}},
+		{"item", &FetchError{Item: "borga", Err: timeout}, []ItemError{{Item: "borga", Error: "timeout"}}},
+		{
+			"joined",
+			errors.Join(&FetchError{Item: "borga", Err: timeout}, timeout),
+			[]ItemError{{Item: "borga", Error: "timeout"}, {Error: "timeout"}},
+		},
+		{
+			"wrapped item",
+			fmt.Errorf("error fetching: %w", &FetchError{Item: "borga", Err: timeout}),
+			[]ItemError{{Item: "borga", Error: "timeout"}},
+		},
+		{"wrapped plain", fmt.Errorf("error fetching: %w", timeout), []ItemError{{Error: "error fetching: timeout"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ItemErrors(test.err); !slices.Equal(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"math"
+	"time"
+)
+
+// CivilTwilight is the solar elevation in degrees below which it is civil
+// night, too dark for webcams without lights.
+const CivilTwilight = -6.0
+
+// SolarElevation is the angle of the sun above the horizon in degrees at the
+// coordinate, from the low precision formulas of the Astronomical Almanac,
+// accurate to about a hundredth of a degree. Refraction is not included.
+func SolarElevation(longitude float64, latitude float64, t time.Time) float64 {
+	// Days since J2000.0, 2000-01-01 12:00 UTC
+	days := float64(t.UTC().UnixNano()-946728000e9) / float64(24*time.Hour)
+
+	meanAnomaly := radians(357.529 + 0.98560028*days)
+	meanLongitude := 280.459 + 0.98564736*days
+	eclipticLongitude := radians(meanLongitude + 1.915*math.Sin(meanAnomaly) + 0.020*math.Sin(2*meanAnomaly))
+	obliquity := radians(23.439 - 0.00000036*days)
+
+	rightAscension := math.Atan2(math.Cos(obliquity)*math.Sin(eclipticLongitude), math.Cos(eclipticLongitude))
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(eclipticLongitude))
+
+	siderealHours := 18.697374558 + 24.06570982441908*days
+	hourAngle := radians(siderealHours*15+longitude) - rightAscension
+
+	lat := radians(latitude)
+	elevation := math.Asin(math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle))
+	return elevation * 180 / math.Pi
+}
+
+// IsCivilNight tells whether the sun is below CivilTwilight at the
+// [longitude, latitude] location.
+func IsCivilNight(location []float64, t time.Time) bool {
+	return SolarElevation(location[0], location[1], t) < CivilTwilight
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
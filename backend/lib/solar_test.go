@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSolarElevation(t *testing.T) {
+	// The expected values are the culminations, 90° minus the latitude plus
+	// the declination of the sun, which changes slowly around them
+	tests := []struct {
+		name      string
+		longitude float64
+		latitude  float64
+		time      time.Time
+		want      float64
+	}{
+		{"Stockholm at noon on midsummer", 18.07, 59.33, time.Date(2024, 6, 20, 10, 50, 0, 0, time.UTC), 90 - 59.33 + 23.44},
+		{"Stockholm at midnight on midsummer", 18.07, 59.33, time.Date(2024, 6, 20, 22, 50, 0, 0, time.UTC), 59.33 + 23.44 - 90},
+		{"equator at noon on the equinox", 0, 0, time.Date(2024, 3, 20, 12, 7, 0, 0, time.UTC), 89.9},
+		{"Kiruna at noon on midwinter", 20.23, 67.86, time.Date(2024, 12, 21, 10, 37, 0, 0, time.UTC), 90 - 67.86 - 23.44},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SolarElevation(test.longitude, test.latitude, test.time); math.Abs(got-test.want) > 0.2 {
+				t.Errorf("got %.2f°, want %.2f°", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsCivilNight(t *testing.T) {
+	tests := []struct {
+		name     string
+		location []float64
+		time     time.Time
+		want     bool
+	}{
+		{"Åre at noon in winter", []float64{13.08, 63.40}, time.Date(2024, 12, 21, 11, 0, 0, 0, time.UTC), false},
+		{"Åre at midnight in winter", []float64{13.08, 63.40}, time.Date(2024, 12, 21, 23, 0, 0, 0, time.UTC), true},
+		{"Åre at midnight on midsummer", []float64{13.08, 63.40}, time.Date(2024, 6, 20, 23, 0, 0, 0, time.UTC), false},
+		{"polar night in Kiruna is twilight at noon", []float64{20.23, 67.86}, time.Date(2024, 12, 21, 10, 37, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsCivilNight(test.location, test.time); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
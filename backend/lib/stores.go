@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Stores bundles the stores the ingestion pipeline writes to.
+type Stores struct {
+	Observations ObservationStore
+	History      ObservationHistoryStore
+	Contours     ContourStore
+
+	// client is shared by the Firestore stores
+	client *firestore.Client
+}
+
+// OpenStores opens every store with the backend selected by the config. The
+// Firestore stores share one client.
+func OpenStores(ctx context.Context, config StoreConfig) (*Stores, error) {
+	if config.Backend == StoreBackendFirestore {
+		client, err := NewFirestoreClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Stores{
+			Observations: NewSharedFirestoreObservationStore(client, config.Collection),
+			History:      NewSharedFirestoreHistoryStore(client, config.Collection),
+			Contours:     NewSharedFirestoreContourStore(client),
+			client:       client,
+		}, nil
+	}
+
+	observations, err := OpenObservationStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	history, err := OpenObservationHistoryStore(ctx, config)
+	if err != nil {
+		observations.Close()
+		return nil, err
+	}
+	contours, err := OpenContourStore(ctx, config)
+	if err != nil {
+		observations.Close()
+		history.Close()
+		return nil, err
+	}
+	return &Stores{Observations: observations, History: history, Contours: contours}, nil
+}
+
+func (s *Stores) Close() error {
+	err := errors.Join(s.Observations.Close(), s.History.Close(), s.Contours.Close())
+	if s.client != nil {
+		err = errors.Join(err, s.client.Close())
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testBackends opens fresh memory and file stores, the backends that run
+// without credentials.
+func testBackends(t *testing.T) map[string]*Stores {
+	dir := t.TempDir()
+	return map[string]*Stores{
+		StoreBackendMemory: {
+			Observations: NewMemoryObservationStore(),
+			History:      NewMemoryHistoryStore(),
+			Contours:     NewMemoryContourStore(),
+		},
+		StoreBackendFile: {
+			Observations: NewFileObservationStore(filepath.Join(dir, "observations.json")),
+			History:      NewFileHistoryStore(filepath.Join(dir, "history")),
+			Contours:     NewFileContourStore(filepath.Join(dir, "contours")),
+		},
+	}
+}
+
+func testObservation(id string, observedAt time.Time, temperature *float64, windSpeed *float64) Observation {
+	longitude, latitude := 13.0, 63.4
+	return Observation{Id: &id, Longitude: &longitude, Latitude: &latitude, ObservedAt: &observedAt, TemperatureC: temperature, WindSpeedMs: windSpeed}
+}
+
+func TestObservationStoreContract(t *testing.T) {
+	ctx := context.Background()
+	observedAt := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	for backend, stores := range testBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			store := stores.Observations
+			observations, err := store.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(observations) != 0 {
+				t.Fatalf("new store lists %d observations", len(observations))
+			}
+
+			first := []Observation{
+				testObservation("b", observedAt, floatPtr(-3), floatPtr(4)),
+				testObservation("a", observedAt, floatPtr(1), floatPtr(2)),
+			}
+			if err := store.Put(ctx, first); err != nil {
+				t.Fatal(err)
+			}
+			// Put replaces the whole observation, the wind speed is gone
+			if err := store.Put(ctx, []Observation{testObservation("b", observedAt.Add(time.Hour), floatPtr(-5), nil)}); err != nil {
+				t.Fatal(err)
+			}
+
+			observations, err = store.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(observations) != 2 || *observations[0].Id != "a" || *observations[1].Id != "b" {
+				t.Fatalf("got %d observations, want a and b sorted by id", len(observations))
+			}
+			replaced := observations[1]
+			if replaced.TemperatureC == nil || *replaced.TemperatureC != -5 {
+				t.Errorf("temperature = %v, want -5", replaced.TemperatureC)
+			}
+			if replaced.WindSpeedMs != nil {
+				t.Errorf("wind speed = %v, want it removed", *replaced.WindSpeedMs)
+			}
+			if !replaced.ObservedAt.Equal(observedAt.Add(time.Hour)) {
+				t.Errorf("observed at = %v, want %v", replaced.ObservedAt, observedAt.Add(time.Hour))
+			}
+		})
+	}
+}
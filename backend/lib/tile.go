@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TileCoordinate addresses an XYZ web mercator tile.
+type TileCoordinate struct {
+	Z int
+	X int
+	Y int
+}
+
+// ParseTilePath reads the tile from the last three segments of a path such as
+// /tiles/7/69/32.pbf, the extension must match.
+func ParseTilePath(path string, extension string) (TileCoordinate, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 3 {
+		return TileCoordinate{}, fmt.Errorf("path %q does not end with {z}/{x}/{y}%s", path, extension)
+	}
+	segments = segments[len(segments)-3:]
+	if !strings.HasSuffix(segments[2], extension) {
+		return TileCoordinate{}, fmt.Errorf("path %q does not end with %s", path, extension)
+	}
+	segments[2] = strings.TrimSuffix(segments[2], extension)
+
+	var values [3]int
+	for i, segment := range segments {
+		value, err := strconv.Atoi(segment)
+		if err != nil {
+			return TileCoordinate{}, fmt.Errorf("invalid tile coordinate %q in %q", segment, path)
+		}
+		values[i] = value
+	}
+	tile := TileCoordinate{Z: values[0], X: values[1], Y: values[2]}
+	if tile.Z < 0 || tile.Z > 22 || tile.X < 0 || tile.Y < 0 || tile.X >= 1<<tile.Z || tile.Y >= 1<<tile.Z {
+		return TileCoordinate{}, fmt.Errorf("tile %d/%d/%d is out of range", tile.Z, tile.X, tile.Y)
+	}
+	return tile, nil
+}
+
+// Project returns the position of the coordinate in tile units, the tile
+// covers [0, 1) in both directions.
+func (tile TileCoordinate) Project(longitude float64, latitude float64) (float64, float64) {
+	n := math.Exp2(float64(tile.Z))
+	latitudeRadians := latitude * math.Pi / 180
+	x := (longitude + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(latitudeRadians)+1/math.Cos(latitudeRadians))/math.Pi) / 2 * n
+	return x - float64(tile.X), y - float64(tile.Y)
+}
+
+// Unproject is the inverse of Project.
+func (tile TileCoordinate) Unproject(x float64, y float64) (float64, float64) {
+	n := math.Exp2(float64(tile.Z))
+	longitude := (x+float64(tile.X))/n*360 - 180
+	latitude := math.Atan(math.Sinh(math.Pi*(1-2*(y+float64(tile.Y))/n))) * 180 / math.Pi
+	return longitude, latitude
+}
+
+func (tile TileCoordinate) Bounds() BoundingBox {
+	minLongitude, maxLatitude := tile.Unproject(0, 0)
+	maxLongitude, minLatitude := tile.Unproject(1, 1)
+	return BoundingBox{MinLongitude: minLongitude, MinLatitude: minLatitude, MaxLongitude: maxLongitude, MaxLatitude: maxLatitude}
+}
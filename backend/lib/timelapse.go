@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+const (
+	// TimelapseWidth is the width of timelapse frames in pixels.
+	TimelapseWidth = 480
+	// MaxTimelapseFrames bounds the size of a timelapse, frames are sampled
+	// evenly when more have been archived.
+	MaxTimelapseFrames      = 72
+	timelapseFrameDelay     = 150 * time.Millisecond
+	timelapseLastFrameDelay = 2 * time.Second
+)
+
+// SampleFrames picks at most count of the frames, evenly spread and always
+// including the first and the last.
+func SampleFrames[T any](frames []T, count int) []T {
+	if len(frames) <= count {
+		return frames
+	}
+	if count <= 1 {
+		return frames[len(frames)-1:]
+	}
+	sampled := make([]T, count)
+	for i := range sampled {
+		sampled[i] = frames[i*(len(frames)-1)/(count-1)]
+	}
+	return sampled
+}
+
+// EncodeTimelapse encodes the images as a looping animated GIF, scaled to
+// TimelapseWidth with the aspect ratio of the last image. The last frame is
+// shown a little longer to mark the end of the loop.
+func EncodeTimelapse(images []image.Image) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, errors.New("timelapse needs at least one image")
+	}
+	last := images[len(images)-1].Bounds()
+	width := TimelapseWidth
+	height := max(1, last.Dy()*width/last.Dx())
+
+	animation := &gif.GIF{LoopCount: 0}
+	for i, img := range images {
+		resized := Resize(img, width, height)
+		frame := image.NewPaletted(resized.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, frame.Bounds(), resized, image.Point{})
+
+		delay := timelapseFrameDelay
+		if i == len(images)-1 {
+			delay = timelapseLastFrameDelay
+		}
+		animation.Image = append(animation.Image, frame)
+		// GIF delays are in hundredths of a second
+		animation.Delay = append(animation.Delay, int(delay/(10*time.Millisecond)))
+	}
+
+	var buffer bytes.Buffer
+	if err := gif.EncodeAll(&buffer, animation); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebcamHistoryPrefix is where archived frames are stored, under
+// history/{webcam}/{timestamp}.jpg, or .png for PNG images, next to the
+// latest image {webcam}.jpg.
+const WebcamHistoryPrefix = "history/"
+
+const webcamHistoryTimeFormat = "20060102T150405Z"
+
+// WebcamFrame is an archived image of a webcam.
+type WebcamFrame struct {
+	Time time.Time `json:"time"`
+	URL  string    `json:"url"`
+}
+
+// WebcamName strips the extension from the file name of the latest image,
+// e.g. webcam-borga.jpg is archived as webcam-borga.
+func WebcamName(fileName string) string {
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+func WebcamHistoryDir(name string) string {
+	return WebcamHistoryPrefix + name + "/"
+}
+
+// WebcamHistoryKey is where a frame is archived, with the extension of its
+// decoded image format, e.g. "png", so the key matches its content type.
+func WebcamHistoryKey(name string, capturedAt time.Time, format string) string {
+	return WebcamHistoryDir(name) + capturedAt.UTC().Format(webcamHistoryTimeFormat) + imageExtension(format)
+}
+
+// imageExtension is the file extension of an image format as named by
+// image.Decode.
+func imageExtension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// TimelapseKey is where the animation of the last 24 hours of a webcam is
+// stored, next to its latest image.
+func TimelapseKey(name string) string {
+	return name + ".gif"
+}
+
+// ParseWebcamHistoryKey returns when the frame stored under the key was captured.
+func ParseWebcamHistoryKey(key string) (time.Time, bool) {
+	capturedAt, err := time.Parse(webcamHistoryTimeFormat, WebcamName(path.Base(key)))
+	return capturedAt, err == nil
+}
+
+// RetentionPolicy thins out the archive as frames get older: every frame is
+// kept for KeepAllFor, then one per hour until HourlyFor and one per day
+// until DailyFor, after which frames are deleted.
+type RetentionPolicy struct {
+	KeepAllFor time.Duration
+	HourlyFor  time.Duration
+	DailyFor   time.Duration
+}
+
+// DefaultRetentionPolicy keeps a day at full rate, a week hourly and a ski
+// season daily.
+var DefaultRetentionPolicy = RetentionPolicy{
+	KeepAllFor: 24 * time.Hour,
+	HourlyFor:  7 * 24 * time.Hour,
+	DailyFor:   180 * 24 * time.Hour,
+}
+
+// Expired returns the frames the policy no longer keeps. Of the hourly frames
+// the first of every hour is kept, of the daily frames the one closest to noon
+// UTC, the brightest time of day in our regions.
+func (policy RetentionPolicy) Expired(frames []time.Time, now time.Time) []time.Time {
+	sorted := append([]time.Time(nil), frames...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Before(sorted[j])
+	})
+
+	keptHours := make(map[time.Time]bool)
+	keptDays := make(map[time.Time]time.Time)
+	var expired []time.Time
+	for _, frame := range sorted {
+		age := now.Sub(frame)
+		switch {
+		case age <= policy.KeepAllFor:
+		case age <= policy.HourlyFor:
+			hour := frame.UTC().Truncate(time.Hour)
+			if keptHours[hour] {
+				expired = append(expired, frame)
+			}
+			keptHours[hour] = true
+		case age <= policy.DailyFor:
+			day := frame.UTC().Truncate(24 * time.Hour)
+			noon := day.Add(12 * time.Hour)
+			kept, ok := keptDays[day]
+			if !ok {
+				keptDays[day] = frame
+				continue
+			}
+			if absDuration(frame.Sub(noon)) < absDuration(kept.Sub(noon)) {
+				expired = append(expired, kept)
+				keptDays[day] = frame
+			} else {
+				expired = append(expired, frame)
+			}
+		default:
+			expired = append(expired, frame)
+		}
+	}
+	return expired
+}
+
+func absDuration(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return -duration
+	}
+	return duration
+}
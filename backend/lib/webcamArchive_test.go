@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	policy := RetentionPolicy{KeepAllFor: time.Hour, HourlyFor: 24 * time.Hour, DailyFor: 72 * time.Hour}
+	now := time.Date(2024, 12, 10, 0, 0, 0, 0, time.UTC)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 12, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		frames  []time.Time
+		expired []time.Time
+	}{
+		{"recent frames are kept", []time.Time{at(9, 23, 50), at(9, 23, 40), at(9, 23, 0)}, nil},
+		{"first frame of every hour", []time.Time{at(9, 20, 45), at(9, 20, 5), at(9, 20, 25), at(9, 21, 10)}, []time.Time{at(9, 20, 25), at(9, 20, 45)}},
+		{"frame closest to noon of every day", []time.Time{at(8, 8, 0), at(8, 13, 0), at(8, 11, 30), at(8, 16, 0), at(7, 3, 0)}, []time.Time{at(8, 8, 0), at(8, 13, 0), at(8, 16, 0)}},
+		{"older frames", []time.Time{at(6, 12, 0), at(1, 12, 0)}, []time.Time{at(1, 12, 0), at(6, 12, 0)}},
+		{"on the boundaries", []time.Time{now.Add(-time.Hour), now.Add(-24 * time.Hour), now.Add(-72 * time.Hour)}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expired := policy.Expired(test.frames, now)
+			slices.SortFunc(expired, func(a, b time.Time) int { return a.Compare(b) })
+			if !slices.EqualFunc(expired, test.expired, time.Time.Equal) {
+				t.Errorf("got %v, want %v", expired, test.expired)
+			}
+		})
+	}
+}
+
+func TestParseWebcamHistoryKey(t *testing.T) {
+	capturedAt := time.Date(2024, 12, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		key  string
+		want time.Time
+		ok   bool
+	}{
+		{WebcamHistoryKey("skistar/are", capturedAt, "jpeg"), capturedAt, true},
+		{WebcamHistoryKey("skistar/are", capturedAt.In(time.FixedZone("CET", 3600)), "jpeg"), capturedAt, true},
+		{WebcamHistoryKey("skistar/are", capturedAt, "png"), capturedAt, true},
+		{"history/skistar/are/latest.jpg", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseWebcamHistoryKey(test.key)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("ParseWebcamHistoryKey(%q) = %v, %v, want %v, %v", test.key, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestWebcamHistoryKey(t *testing.T) {
+	capturedAt := time.Date(2024, 12, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"jpeg", "history/webcam-borga/20241201T123000Z.jpg"},
+		{"png", "history/webcam-borga/20241201T123000Z.png"},
+		{"gif", "history/webcam-borga/20241201T123000Z.gif"},
+	}
+	for _, test := range tests {
+		if got := WebcamHistoryKey("webcam-borga", capturedAt, test.format); got != test.want {
+			t.Errorf("WebcamHistoryKey(%q) = %s, want %s", test.format, got, test.want)
+		}
+	}
+}
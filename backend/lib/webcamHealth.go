@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Health of a webcam as returned by fetchWebcams. Broken webcams failed their
+// last update, stale webcams have shown the same image for too long and dark
+// webcams show a night time image.
+const (
+	HealthOK     = "ok"
+	HealthStale  = "stale"
+	HealthBroken = "broken"
+	HealthDark   = "dark"
+)
+
+// WebcamHealthPolicy holds the thresholds of the webcam health check.
+type WebcamHealthPolicy struct {
+	// StaleAfter is how long the image may be unchanged.
+	StaleAfter time.Duration
+	// MinBytes is the size below which an image is taken for an error
+	// placeholder.
+	MinBytes int
+	// DarkBrightness is the mean brightness, 0 to 1, below which an image is dark.
+	DarkBrightness float64
+}
+
+var DefaultWebcamHealthPolicy = WebcamHealthPolicy{
+	StaleAfter:     6 * time.Hour,
+	MinBytes:       2048,
+	DarkBrightness: 0.08,
+}
+
+// Check returns why a fetched image is not a usable webcam image.
+func (policy WebcamHealthPolicy) Check(webcamImage WebcamImage) error {
+	contentType := webcamImage.ContentType
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("content type %s is not an image", contentType)
+	}
+	if len(webcamImage.Data) < policy.MinBytes {
+		return fmt.Errorf("image is only %d bytes", len(webcamImage.Data))
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(webcamImage.Data)); err != nil {
+		return fmt.Errorf("error decoding image: %w", err)
+	}
+	return nil
+}
+
+// Health returns the health of a webcam from the metadata of its latest
+// image, and why it is not ok.
+func (policy WebcamHealthPolicy) Health(metadata map[string]string, now time.Time) (string, string) {
+	if message := metadata["error"]; message != "" {
+		return HealthBroken, message
+	}
+	// Night images are not fetched, so the latest image is also stale
+	if metadata["night"] == "true" {
+		return HealthDark, "night"
+	}
+	if lastChanged, err := time.Parse(time.RFC3339, metadata["lastChanged"]); err == nil && now.Sub(lastChanged) > policy.StaleAfter {
+		return HealthStale, fmt.Sprintf("unchanged since %s", metadata["lastChanged"])
+	}
+	if brightness, err := strconv.ParseFloat(metadata["brightness"], 64); err == nil && brightness < policy.DarkBrightness {
+		return HealthDark, fmt.Sprintf("mean brightness %.2f", brightness)
+	}
+	return HealthOK, ""
+}
@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebcamHealth(t *testing.T) {
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	changed := func(ago time.Duration) string {
+		return now.Add(-ago).Format(time.RFC3339)
+	}
+	tests := []struct {
+		name     string
+		policy   WebcamHealthPolicy
+		metadata map[string]string
+		health   string
+		reason   string
+	}{
+		{"ok", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": changed(time.Hour), "brightness": "0.4"}, HealthOK, ""},
+		{"no metadata", DefaultWebcamHealthPolicy, map[string]string{}, HealthOK, ""},
+		{"broken", DefaultWebcamHealthPolicy, map[string]string{"error": "bad status: 404 Not Found", "lastChanged": changed(time.Hour)}, HealthBroken, "bad status: 404 Not Found"},
+		{"broken before stale", DefaultWebcamHealthPolicy, map[string]string{"error": "image is only 12 bytes", "lastChanged": changed(48 * time.Hour)}, HealthBroken, "image is only 12 bytes"},
+		{"night", DefaultWebcamHealthPolicy, map[string]string{"night": "true", "lastChanged": changed(12 * time.Hour), "brightness": "0.4"}, HealthDark, "night"},
+		{"stale", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": changed(7 * time.Hour)}, HealthStale, "unchanged since " + changed(7*time.Hour)},
+		{"on the stale threshold", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": changed(6 * time.Hour)}, HealthOK, ""},
+		{"configured stale threshold", WebcamHealthPolicy{StaleAfter: time.Hour}, map[string]string{"lastChanged": changed(2 * time.Hour)}, HealthStale, "unchanged since " + changed(2*time.Hour)},
+		{"stale before dark", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": changed(7 * time.Hour), "brightness": "0.01"}, HealthStale, "unchanged since " + changed(7*time.Hour)},
+		{"dark", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": changed(time.Hour), "brightness": "0.05"}, HealthDark, "mean brightness 0.05"},
+		{"on the dark threshold", DefaultWebcamHealthPolicy, map[string]string{"brightness": "0.08"}, HealthOK, ""},
+		{"unreadable values", DefaultWebcamHealthPolicy, map[string]string{"lastChanged": "yesterday", "brightness": "dim"}, HealthOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health, reason := test.policy.Health(test.metadata, now)
+			if health != test.health || reason != test.reason {
+				t.Errorf("got %s %q, want %s %q", health, reason, test.health, test.reason)
+			}
+		})
+	}
+}
+
+func TestWebcamHealthPolicyCheck(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	valid := buffer.Bytes()
+	tests := []struct {
+		name     string
+		minBytes int
+		image    WebcamImage
+		wantErr  string
+	}{
+		{"valid", len(valid), WebcamImage{Data: valid, ContentType: "image/jpeg"}, ""},
+		{"no content type", len(valid), WebcamImage{Data: valid}, ""},
+		{"below min bytes", len(valid) + 1, WebcamImage{Data: valid, ContentType: "image/jpeg"}, "bytes"},
+		{"not an image", 0, WebcamImage{Data: valid, ContentType: "text/html"}, "not an image"},
+		{"undecodable", 0, WebcamImage{Data: []byte("<html>camera offline</html>"), ContentType: "image/jpeg"}, "error decoding image"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := DefaultWebcamHealthPolicy
+			policy.MinBytes = test.minBytes
+			err := policy.Check(test.image)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got %v, want an error with %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestWebcamHealthTransitions updates a webcam step by step and checks the
+// health reported from the metadata of its latest image.
+func TestWebcamHealthTransitions(t *testing.T) {
+	encode := func(img image.Image) []byte {
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+	daylight := encode(testImage())
+	dark := encode(uniformImage(64, 48, 2))
+
+	var status int
+	var data []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store := NewLocalImageStore(t.TempDir(), "")
+	policy := WebcamHealthPolicy{StaleAfter: 6 * time.Hour, MinBytes: 100, DarkBrightness: 0.08}
+	// Åre, in civil night at 04:00 UTC in December and in daylight at noon
+	location := []float64{13.08, 63.40}
+	night := time.Date(2024, 12, 1, 4, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name   string
+		status int
+		data   []byte
+		night  bool
+		health string
+	}{
+		{name: "first image", status: http.StatusOK, data: daylight, health: HealthOK},
+		{name: "upstream fails", status: http.StatusNotFound, health: HealthBroken},
+		{name: "recovers with the same image", status: http.StatusOK, data: daylight, health: HealthOK},
+		{name: "placeholder below min bytes", status: http.StatusOK, data: daylight[:50], health: HealthBroken},
+		{name: "dark image", status: http.StatusOK, data: dark, health: HealthDark},
+		{name: "light again", status: http.StatusOK, data: daylight, health: HealthOK},
+		{name: "civil night", night: true, health: HealthDark},
+		{name: "unchanged image in the morning", status: http.StatusOK, data: daylight, health: HealthOK},
+	}
+	for _, step := range steps {
+		if step.night {
+			if !SkipAtNight(ctx, store, "webcam.jpg", location, night) {
+				t.Fatalf("%s: not skipped at night", step.name)
+			}
+		} else {
+			status, data = step.status, step.data
+			UploadWebcamImage(ctx, store, server.URL, "webcam.jpg", location, policy)
+		}
+
+		info, err := store.Stat(ctx, "webcam.jpg")
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if health, reason := policy.Health(info.Metadata, time.Now()); health != step.health {
+			t.Errorf("%s: health %s (%s), want %s", step.name, health, reason, step.health)
+		}
+	}
+}
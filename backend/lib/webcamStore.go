@@ -0,0 +1,347 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebcamImage is a fetched webcam image. ETag and LastModified are the
+// validators of the upstream response, sent with the next request.
+type WebcamImage struct {
+	Data         []byte
+	Location     []float64
+	CapturedAt   time.Time
+	ContentType  string
+	ETag         string
+	LastModified string
+}
+
+// UploadWebcamImage fetches the image at the url and stores it as the latest
+// image of the webcam, see StoreWebcamImage. The request is conditional on
+// the validators of the latest image and nothing is written when the camera
+// has not refreshed, which is reported by returning false. Failed fetches and
+// images the policy rejects are recorded on the latest image, see
+// RecordWebcamError.
+func UploadWebcamImage(ctx context.Context, store ImageStore, url string, fileName string, location []float64, policy WebcamHealthPolicy) (bool, error) {
+	latest, err := store.Stat(ctx, fileName)
+	if err != nil && !errors.Is(err, ErrImageNotFound) {
+		log.Printf("Failed to read latest image of %s, fetching unconditionally: %v", fileName, err)
+	}
+
+	webcamImage, err := fetchImage(ctx, url, latest.Metadata)
+	if err == nil && webcamImage != nil {
+		err = policy.Check(*webcamImage)
+	}
+	if err != nil {
+		RecordWebcamError(ctx, store, fileName, err)
+		return false, err
+	}
+	if webcamImage == nil || ContentHash(webcamImage.Data) == latest.Metadata["contentHash"] {
+		log.Printf("%s is unchanged since %s\n", fileName, latest.Metadata["lastChanged"])
+		if latest.Metadata["error"] != "" || latest.Metadata["night"] != "" {
+			clearWebcamFlags(ctx, store, fileName)
+		}
+		return false, nil
+	}
+	webcamImage.Location = location
+	webcamImage.CapturedAt = time.Now().UTC()
+	if err := StoreWebcamImage(ctx, store, fileName, *webcamImage); err != nil {
+		return false, err
+	}
+	log.Printf("Successfully uploaded %s\n", fileName)
+	return true, nil
+}
+
+// fetchImage sends If-None-Match and If-Modified-Since from the metadata of
+// the latest image, it returns nil when upstream answers Not Modified.
+func fetchImage(ctx context.Context, url string, latest map[string]string) (*WebcamImage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag := latest["etag"]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := latest["lastModified"]; lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	return &WebcamImage{
+		Data:         data,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// RecordWebcamError marks the latest image of the webcam as broken until the
+// next successful update, failures to do so are only logged.
+func RecordWebcamError(ctx context.Context, store ImageStore, fileName string, fetchErr error) {
+	metadata := map[string]string{
+		"error":    fetchErr.Error(),
+		"failedAt": time.Now().UTC().Format(time.RFC3339),
+	}
+	err := store.UpdateMetadata(ctx, fileName, metadata)
+	if err != nil && !errors.Is(err, ErrImageNotFound) {
+		log.Printf("Failed to record error of %s: %v", fileName, err)
+	}
+}
+
+// clearWebcamFlags removes the error and night marks of the latest image when
+// it is unchanged, a changed image is stored without them.
+func clearWebcamFlags(ctx context.Context, store ImageStore, fileName string) {
+	if err := store.UpdateMetadata(ctx, fileName, map[string]string{"error": "", "failedAt": "", "night": ""}); err != nil {
+		log.Printf("Failed to clear flags of %s: %v", fileName, err)
+	}
+}
+
+// SkipAtNight tells whether it is civil night at the webcam, when its image
+// is not fetched. The latest image is marked with night "true" once a night.
+func SkipAtNight(ctx context.Context, store ImageStore, fileName string, location []float64, now time.Time) bool {
+	if !IsCivilNight(location, now) {
+		return false
+	}
+	latest, err := store.Stat(ctx, fileName)
+	if err != nil {
+		if !errors.Is(err, ErrImageNotFound) {
+			log.Printf("Failed to read latest image of %s: %v", fileName, err)
+		}
+		return true
+	}
+	if latest.Metadata["night"] != "true" {
+		if err := store.UpdateMetadata(ctx, fileName, map[string]string{"night": "true"}); err != nil {
+			log.Printf("Failed to mark %s as night: %v", fileName, err)
+		}
+	}
+	return true
+}
+
+// ContentHash identifies the content of an image, it is stored as the
+// contentHash metadata of the latest image.
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StoreWebcamImage stores the image as the latest image of the webcam with its
+// renditions, archives a copy under its history, see WebcamHistoryKey, and
+// prunes the history. Images are only stored when they changed, so the
+// capture time is recorded as lastChanged. The metadata holds the stats of
+// MeasureImage.
+func StoreWebcamImage(ctx context.Context, store ImageStore, fileName string, webcamImage WebcamImage) error {
+	capturedAt := webcamImage.CapturedAt
+	data := webcamImage.Data
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error decoding image: %w", err)
+	}
+	// The original bytes are stored, so their type is the decoded format,
+	// e.g. image/png, whatever the webcam sent as its content type
+	contentType := "image/" + format
+	metadata := map[string]string{
+		"location":    fmt.Sprintf(`[%f, %f]`, webcamImage.Location[0], webcamImage.Location[1]),
+		"capturedAt":  capturedAt.Format(time.RFC3339),
+		"lastChanged": capturedAt.Format(time.RFC3339),
+		"contentHash": ContentHash(data),
+	}
+	maps.Copy(metadata, MeasureImage(img).Metadata())
+	if webcamImage.ETag != "" {
+		metadata["etag"] = webcamImage.ETag
+	}
+	if webcamImage.LastModified != "" {
+		metadata["lastModified"] = webcamImage.LastModified
+	}
+
+	name := WebcamName(fileName)
+	history := PutOptions{ContentType: contentType, CacheControl: "public, max-age=31536000, immutable", Metadata: metadata}
+	if err := store.Put(ctx, WebcamHistoryKey(name, capturedAt, format), data, history); err != nil {
+		return err
+	}
+
+	// The renditions are written first, the latest image lists those available
+	renditions, err := writeRenditions(ctx, store, name, img)
+	if err != nil {
+		log.Printf("Failed to write renditions of %s: %v", name, err)
+	}
+	latestMetadata := maps.Clone(metadata)
+	latestMetadata["renditions"] = strings.Join(renditions, ",")
+	latest := PutOptions{ContentType: contentType, CacheControl: "public, max-age=180", Metadata: latestMetadata}
+	if err := store.Put(ctx, fileName, data, latest); err != nil {
+		return err
+	}
+	if err := pruneWebcamHistory(ctx, store, name, capturedAt); err != nil {
+		log.Printf("Failed to prune history of %s: %v", name, err)
+	}
+	return nil
+}
+
+// writeRenditions stores the renditions of the image and returns their names.
+func writeRenditions(ctx context.Context, store ImageStore, name string, img image.Image) ([]string, error) {
+	renditions, err := RenderRenditions(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, rendition := range WebcamRenditions {
+		data, ok := renditions[rendition.Name]
+		if !ok {
+			continue
+		}
+		// Renditions are always encoded as JPEG
+		options := PutOptions{ContentType: "image/jpeg", CacheControl: "public, max-age=180"}
+		if err := store.Put(ctx, RenditionKey(name, rendition.Name), data, options); err != nil {
+			return written, err
+		}
+		written = append(written, rendition.Name)
+	}
+	return written, nil
+}
+
+// listWebcamHistory returns the archived frames of the webcam keyed by capture time.
+func listWebcamHistory(ctx context.Context, store ImageStore, name string) (map[time.Time]ImageInfo, error) {
+	images, err := store.List(ctx, WebcamHistoryDir(name), false)
+	if err != nil {
+		return nil, fmt.Errorf("error listing history of %s: %w", name, err)
+	}
+	frames := make(map[time.Time]ImageInfo)
+	for _, info := range images {
+		if capturedAt, ok := ParseWebcamHistoryKey(info.Key); ok {
+			frames[capturedAt] = info
+		}
+	}
+	return frames, nil
+}
+
+// pruneWebcamHistory deletes the frames DefaultRetentionPolicy no longer keeps.
+func pruneWebcamHistory(ctx context.Context, store ImageStore, name string, now time.Time) error {
+	frames, err := listWebcamHistory(ctx, store, name)
+	if err != nil {
+		return err
+	}
+	times := make([]time.Time, 0, len(frames))
+	for capturedAt := range frames {
+		times = append(times, capturedAt)
+	}
+	for _, capturedAt := range DefaultRetentionPolicy.Expired(times, now) {
+		if err := store.Delete(ctx, frames[capturedAt].Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebcamHistory returns the archived frames of the webcam captured between
+// from and to, oldest first.
+func WebcamHistory(ctx context.Context, store ImageStore, name string, from time.Time, to time.Time) ([]WebcamFrame, error) {
+	frames, err := listWebcamHistory(ctx, store, name)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []WebcamFrame{}
+	for capturedAt, info := range frames {
+		if capturedAt.Before(from) || capturedAt.After(to) {
+			continue
+		}
+		history = append(history, WebcamFrame{Time: capturedAt, URL: info.URL})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history, nil
+}
+
+// UpdateWebcamTimelapse renders the frames archived during the last 24 hours
+// into an animated GIF stored next to the latest image, see TimelapseKey. It
+// returns the number of frames, webcams with less than two frames are skipped.
+func UpdateWebcamTimelapse(ctx context.Context, store ImageStore, name string, now time.Time) (int, error) {
+	frames, err := listWebcamHistory(ctx, store, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var times []time.Time
+	for capturedAt := range frames {
+		if now.Sub(capturedAt) <= 24*time.Hour {
+			times = append(times, capturedAt)
+		}
+	}
+	if len(times) < 2 {
+		return 0, nil
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+	times = SampleFrames(times, MaxTimelapseFrames)
+
+	images := make([]image.Image, 0, len(times))
+	for _, capturedAt := range times {
+		img, err := readImage(ctx, store, frames[capturedAt].Key)
+		if err != nil {
+			log.Printf("Skipping frame of %s: %v", name, err)
+			continue
+		}
+		images = append(images, img)
+	}
+	if len(images) < 2 {
+		return 0, fmt.Errorf("only %d of %d frames could be read", len(images), len(times))
+	}
+
+	animation, err := EncodeTimelapse(images)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding timelapse: %w", err)
+	}
+	metadata := map[string]string{
+		"from": times[0].Format(time.RFC3339),
+		"to":   times[len(times)-1].Format(time.RFC3339),
+	}
+	options := PutOptions{ContentType: "image/gif", CacheControl: "public, max-age=600", Metadata: metadata}
+	if err := store.Put(ctx, TimelapseKey(name), animation, options); err != nil {
+		return 0, err
+	}
+	return len(images), nil
+}
+
+func readImage(ctx context.Context, store ImageStore, key string) (image.Image, error) {
+	data, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", key, err)
+	}
+	return img, nil
+}
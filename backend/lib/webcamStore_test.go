@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestStoreWebcamImageContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		encode      func(*bytes.Buffer, image.Image) error
+		contentType string
+		historyKey  string
+	}{
+		{"jpeg", func(buffer *bytes.Buffer, img image.Image) error { return jpeg.Encode(buffer, img, nil) }, "image/jpeg", "history/test/20241201T120000Z.jpg"},
+		{"png", func(buffer *bytes.Buffer, img image.Image) error { return png.Encode(buffer, img) }, "image/png", "history/test/20241201T120000Z.png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := test.encode(&buffer, testImage()); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			store := NewLocalImageStore(t.TempDir(), "")
+			capturedAt := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+			// The webcam claims JPEG whatever it sends
+			webcamImage := WebcamImage{Data: buffer.Bytes(), Location: []float64{13, 63}, CapturedAt: capturedAt, ContentType: "image/jpeg"}
+			if err := StoreWebcamImage(ctx, store, "test.jpg", webcamImage); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, key := range []string{"test.jpg", test.historyKey} {
+				info, err := store.Stat(ctx, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.ContentType != test.contentType {
+					t.Errorf("%s content type = %s, want %s", key, info.ContentType, test.contentType)
+				}
+			}
+			for _, rendition := range WebcamRenditions {
+				info, err := store.Stat(ctx, RenditionKey("test", rendition.Name))
+				if err != nil {
+					continue
+				}
+				if info.ContentType != "image/jpeg" {
+					t.Errorf("rendition %s content type = %s, want image/jpeg", rendition.Name, info.ContentType)
+				}
+			}
+		})
+	}
+}
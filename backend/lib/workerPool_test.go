@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		items   int
+		want    int
+	}{
+		{"bounded by workers", 3, 10, 3},
+		{"bounded by items", 8, 2, 2},
+		{"at least one worker", 0, 3, 1},
+		{"no items", 4, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := make([]int, test.items)
+			for i := range items {
+				items[i] = i
+			}
+			var inFlight, maxInFlight atomic.Int32
+			var mu sync.Mutex
+			done := make(map[int]bool)
+			err := ForEach(context.Background(), test.workers, items, func(ctx context.Context, item int) error {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					seen := maxInFlight.Load()
+					if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				done[item] = true
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := int(maxInFlight.Load()); got != test.want {
+				t.Errorf("%d items in flight, want %d", got, test.want)
+			}
+			if len(done) != test.items {
+				t.Errorf("%d of %d items done", len(done), test.items)
+			}
+		})
+	}
+}
+
+func TestForEachErrors(t *testing.T) {
+	failures := map[int]error{}
+	for _, item := range []int{1, 4, 7} {
+		failures[item] = fmt.Errorf("item %d failed", item)
+	}
+	var calls atomic.Int32
+	err := ForEach(context.Background(), 3, []int{0, 1, 2, 3, 4, 5, 6, 7}, func(ctx context.Context, item int) error {
+		calls.Add(1)
+		return failures[item]
+	})
+	if calls.Load() != 8 {
+		t.Errorf("%d calls, want every item despite the failures", calls.Load())
+	}
+	for item, failure := range failures {
+		if !errors.Is(err, failure) {
+			t.Errorf("the error of item %d is missing from %v", item, err)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("got a context error without cancelling: %v", err)
+	}
+}
+
+func TestForEachCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failure := errors.New("item 1 failed")
+	var started []int
+	err := ForEach(ctx, 1, []int{0, 1, 2, 3, 4}, func(ctx context.Context, item int) error {
+		started = append(started, item)
+		if item == 1 {
+			cancel()
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, failure) {
+		t.Errorf("got %v, want the item error joined with the context error", err)
+	}
+	// The single worker may already have taken the next item when the context
+	// was cancelled, the rest are skipped
+	if len(started) < 2 || len(started) > 3 {
+		t.Errorf("started %v, want the items up to the cancellation", started)
+	}
+}
@@ -0,0 +1,45 @@
+package functions
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("tiles", ObservationTiles)
+}
+
+// ObservationTiles serves the current observations as Mapbox Vector Tiles at
+// /tiles/{z}/{x}/{y}.pbf. The same filters as fetchObservations are supported.
+// The observations are read at most once per observationCacheTTL.
+func ObservationTiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	tile, err := lib.ParseTilePath(r.URL.Path, ".pbf")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseObservationFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	observations, err := loadCachedObservations(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to load observations: %v", err)
+		http.Error(w, "Failed to load observations", http.StatusInternalServerError)
+		return
+	}
+
+	data := lib.EncodeObservationTile(observations, tile, lib.DefaultTileOptions)
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Cache-Control", "public, max-age=120")
+	w.Write(data)
+}
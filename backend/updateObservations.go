@@ -0,0 +1,90 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("updateObservations", UpdateObservations)
+}
+
+// UpdateObservations runs the ingestion pipeline for every registered provider,
+// or only for the one given by the provider query parameter.
+func UpdateObservations(w http.ResponseWriter, r *http.Request) {
+	providers := lib.Providers()
+	if name := r.URL.Query().Get("provider"); name != "" {
+		provider, ok := lib.GetProvider(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown provider %q", name), http.StatusNotFound)
+			return
+		}
+		providers = []lib.ObservationProvider{provider}
+	}
+
+	ingestProviders(w, r, providers)
+}
+
+// ingestProvider is the shared body of the per-provider update functions.
+func ingestProvider(w http.ResponseWriter, r *http.Request, name string) {
+	provider, ok := lib.GetProvider(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown provider %q", name), http.StatusInternalServerError)
+		return
+	}
+	ingestProviders(w, r, []lib.ObservationProvider{provider})
+}
+
+// ingestProviders runs the ingestion pipeline for the providers, publishes the
+// contours of the new observations and writes the run report.
+func ingestProviders(w http.ResponseWriter, r *http.Request, providers []lib.ObservationProvider) {
+	stores, err := lib.OpenStores(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open stores: %v", err)
+		http.Error(w, "Failed to open stores", http.StatusInternalServerError)
+		return
+	}
+	defer stores.Close()
+
+	report := lib.NewRunReport()
+	ingested := false
+	for _, provider := range providers {
+		result, err := lib.Ingest(r.Context(), provider, stores, activeRegions)
+		if err != nil {
+			log.Printf("Failed to ingest %s: %v", provider.Name(), err)
+		}
+		report.AddIngest(result, err)
+		ingested = ingested || err == nil || result.Stored > 0
+	}
+	observationCache.Invalidate()
+
+	// Without new observations the contours are unchanged, and publishing them
+	// would keep a run where every provider failed from being reported as failed
+	if ingested {
+		published, err := publishContours(r.Context(), stores)
+		if err != nil {
+			log.Printf("Failed to publish contours: %v", err)
+		}
+		report.Add("contours", published, err)
+	}
+
+	writeRunReport(w, report)
+}
+
+// writeRunReport finishes the report and writes it as JSON, with status 500
+// only when every source failed so that partial runs are not retried.
+func writeRunReport(w http.ResponseWriter, report *lib.RunReport) {
+	report.Finish()
+	log.Printf("Run finished with status %s", report.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == lib.StatusFailed {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,107 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+type fakeProvider struct {
+	name         string
+	observations []lib.Observation
+	err          error
+}
+
+func (provider fakeProvider) Name() string {
+	return provider.name
+}
+
+func (provider fakeProvider) Fetch(ctx context.Context) ([]lib.Observation, error) {
+	return provider.observations, provider.err
+}
+
+func fakeObservation(id string, temperature float64) lib.Observation {
+	latitude, longitude := 63.2, 14.0
+	observedAt := time.Now().UTC().Truncate(time.Hour)
+	return lib.Observation{Id: &id, Latitude: &latitude, Longitude: &longitude, TemperatureC: &temperature, ObservedAt: &observedAt}
+}
+
+func TestIngestProviders(t *testing.T) {
+	t.Setenv("STORE_BACKEND", lib.StoreBackendMemory)
+
+	unavailable := errors.New("unavailable")
+	working := fakeProvider{name: "working", observations: []lib.Observation{fakeObservation("working-1", -2), fakeObservation("working-2", -4)}}
+	failing := fakeProvider{name: "failing", err: unavailable}
+	partial := fakeProvider{
+		name:         "partial",
+		observations: []lib.Observation{fakeObservation("partial-1", -3)},
+		err:          &lib.FetchError{Item: "partial-2", Err: unavailable},
+	}
+	tests := []struct {
+		name      string
+		providers []lib.ObservationProvider
+		code      int
+		status    string
+		sources   map[string]string
+	}{
+		{
+			"every provider ok",
+			[]lib.ObservationProvider{working},
+			http.StatusOK, lib.StatusOK,
+			map[string]string{"working": lib.StatusOK, "contours": lib.StatusOK},
+		},
+		{
+			"a provider failed",
+			[]lib.ObservationProvider{working, failing},
+			http.StatusOK, lib.StatusPartial,
+			map[string]string{"working": lib.StatusOK, "failing": lib.StatusFailed, "contours": lib.StatusOK},
+		},
+		{
+			"a station failed",
+			[]lib.ObservationProvider{partial},
+			http.StatusOK, lib.StatusPartial,
+			map[string]string{"partial": lib.StatusPartial, "contours": lib.StatusOK},
+		},
+		{
+			"every provider failed",
+			[]lib.ObservationProvider{failing, failing},
+			http.StatusInternalServerError, lib.StatusFailed,
+			map[string]string{"failing": lib.StatusFailed},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ingestProviders(recorder, httptest.NewRequest(http.MethodPost, "/updateObservations", nil), test.providers)
+
+			if recorder.Code != test.code {
+				t.Errorf("code = %d, want %d", recorder.Code, test.code)
+			}
+			var report lib.RunReport
+			if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != test.status {
+				t.Errorf("status = %s, want %s", report.Status, test.status)
+			}
+			sources := make(map[string]string)
+			for _, source := range report.Sources {
+				sources[source.Source] = source.Status
+			}
+			if len(sources) != len(test.sources) {
+				t.Errorf("sources = %v, want %v", sources, test.sources)
+			}
+			for source, status := range test.sources {
+				if sources[source] != status {
+					t.Errorf("source %s is %q, want %s", source, sources[source], status)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package functions
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/Yeetii/live-weather/lib"
 
@@ -11,57 +14,51 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
-type SkistarInput struct {
-	WebcamId string
-	Location []float64
-}
-
 func init() {
 	functions.HTTP("updateSkiStarWebcams", UpdateSkiStarWebcams)
 }
 
-// Tege berg = 61
-// Tväråvalvet = 62
-// Fjällgård = 63
-// Stjärntorget = 77
-// Kabin = 44
-// Sadel = 60
-// VM-platå = 45
-// Förberget = 49
-
+// UpdateSkiStarWebcams uploads the latest image of every configured Skistar webcam.
 func UpdateSkiStarWebcams(w http.ResponseWriter, r *http.Request) {
-	inputs := []SkistarInput{{WebcamId: "46", Location: []float64{13.061854, 63.386158}},
-		{WebcamId: "61", Location: []float64{12.97008963763537, 63.410562604101635}},
-		{WebcamId: "62", Location: []float64{13.063774, 63.436330}},
-		{WebcamId: "63", Location: []float64{13.112216429602679, 63.40863152963157}},
-		{WebcamId: "77", Location: []float64{13.07677168424639, 63.402590779054385}},
-		{WebcamId: "44", Location: []float64{13.079073, 63.427271}},
-		{WebcamId: "60", Location: []float64{13.113218812480724, 63.40418386515296}},
-		{WebcamId: "45", Location: []float64{13.063259360877352, 63.41586041513909}},
-		{WebcamId: "49", Location: []float64{13.182920769760132, 63.38747245909455}},
-	}
-
-	for _, input := range inputs {
-		var url = scrapeWebcamUrl(input.WebcamId)
-		var fileName = fmt.Sprintf("skistar-webcam-%s.jpg", input.WebcamId)
-		lib.UploadToFirebaseStorage(url, fileName, input.Location)
-	}
-}
-
-func scrapeWebcamUrl(webcamId string) string {
-	res, err := http.Get("https://www.skistar.com/sv/vara-skidorter/are/vinter-i-are/vader-och-backar/webbkameror-are/WebCam/?webcamId=" + webcamId)
+	store, err := lib.OpenImageStore(r.Context(), lib.LoadStoreConfig())
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Failed to open image store: %v", err)
+		http.Error(w, "Failed to open image store", http.StatusInternalServerError)
+		return
 	}
-	defer res.Body.Close()
+	defer store.Close()
 
-	if res.StatusCode != 200 {
-		log.Fatalf("Failed to fetch the webpage: %s", res.Status)
+	report := lib.NewRunReport()
+	uploaded := 0
+	var errs []error
+	now := time.Now().UTC()
+	for _, webcam := range appConfig.SkistarWebcams {
+		var fileName = skistarWebcamFileName(webcam.Id)
+		if lib.SkipAtNight(r.Context(), store, fileName, webcam.Location, now) {
+			log.Printf("Skipping webcam %s at night", webcam.Id)
+			continue
+		}
+		url, err := scrapeWebcamUrl(r.Context(), webcam.Id)
+		if err == nil {
+			_, err = lib.UploadWebcamImage(r.Context(), store, url, fileName, webcam.Location, webcamHealthPolicy)
+		} else {
+			lib.RecordWebcamError(r.Context(), store, fileName, err)
+		}
+		if err != nil {
+			log.Printf("Failed to update webcam %s: %v", webcam.Id, err)
+			errs = append(errs, &lib.FetchError{Item: webcam.Id, Err: err})
+			continue
+		}
+		uploaded++
 	}
+	report.Add("skistar-webcams", uploaded, errors.Join(errs...))
+	writeRunReport(w, report)
+}
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+func scrapeWebcamUrl(ctx context.Context, webcamId string) (string, error) {
+	doc, err := fetchDocument(ctx, appConfig.Providers.Skistar.WebcamPageUrl+webcamId)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
 	// Find the input element with data-range-mapper-value="23" and extract the data-image-url.
@@ -74,6 +71,9 @@ func scrapeWebcamUrl(webcamId string) string {
 			fmt.Printf("Webcam Image URL (range 23): %s\n", imageUrl)
 		}
 	})
+	if len(imageUrl) <= 5 {
+		return "", fmt.Errorf("no image url found for webcam %s", webcamId)
+	}
 	var largeImageUrl = imageUrl[:len(imageUrl)-5]
-	return largeImageUrl
+	return largeImageUrl, nil
 }
@@ -1,67 +1,86 @@
 package functions
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/Yeetii/live-weather/lib"
 )
 
-type SkistarWeatherInput struct {
-	Id             string
-	Url            string
-	TopLocation    []float64
-	BottomLocation []float64
-}
-
 func init() {
+	lib.RegisterProvider(skistarProvider{})
 	functions.HTTP("updateSkistarWeather", updateSkistarWeather)
 }
 
 func updateSkistarWeather(w http.ResponseWriter, r *http.Request) {
-	inputs := []SkistarWeatherInput{
-		{Id: "areby", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=areby", TopLocation: []float64{63.41634525563247, 13.06472146254914}, BottomLocation: []float64{63.403513916879106, 13.059243790348805}},
-		{Id: "hogzon", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=hogzon", TopLocation: []float64{63.42746531861163, 13.07798918790169}, BottomLocation: nil},
-		{Id: "bjornen", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=bjornen", TopLocation: []float64{63.40397330198576, 13.112439722480248}, BottomLocation: []float64{63.39058903591519, 13.124520371380962}},
-		{Id: "duved", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=duved", TopLocation: []float64{63.40925052213198, 12.933974437408123}, BottomLocation: []float64{63.39653432268454, 12.924465636198212}},
-		{Id: "vemdalsskalet", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=vemdalsskalet", TopLocation: []float64{62.483387, 13.956566}, BottomLocation: []float64{62.484503, 13.967102}},
-		{Id: "bjornrike", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=bjornrike", TopLocation: []float64{62.41864, 13.98688}, BottomLocation: []float64{62.42142, 13.95809}},
-		{Id: "klovsjostorhogna", Url: "https://www.skistar.com/Lpv/Forecast?lang=sv&area=klovsjostorhogna", TopLocation: []float64{62.49811, 14.09203}, BottomLocation: []float64{62.49464, 14.11936}},
-	}
+	ingestProvider(w, r, "skistar")
+}
 
-	var observations []lib.Observation
+type skistarProvider struct{}
 
-	for _, input := range inputs {
-		var weather = scrapeCurrentWeather(input.Url)
-		if input.TopLocation != nil {
-			id := "skistar-" + input.Id + "-top"
-			observation := lib.Observation{Id: &id, Latitude: &input.TopLocation[0], Longitude: &input.TopLocation[1], TemperatureC: &weather.TemperatureTop, WindSpeedMs: &weather.WindSpeedTop, WindGustSpeedMs: &weather.GustWindpeedTop}
+func (skistarProvider) Name() string {
+	return "skistar"
+}
+
+func (skistarProvider) Fetch(ctx context.Context) ([]lib.Observation, error) {
+	var observations []lib.Observation
+	var errs []error
+	observedAt := skistarObservedAt(time.Now())
+
+	for _, resort := range appConfig.Resorts {
+		var areas []string
+		for _, area := range resort.Areas {
+			areas = append(areas, area.Id)
+			weather, err := scrapeCurrentWeather(ctx, area.ForecastUrl)
+			if err != nil {
+				errs = append(errs, &lib.FetchError{Item: area.Id, Err: err})
+				continue
+			}
+			id := "skistar-" + area.Id + "-top"
+			observation := lib.Observation{Id: &id, Longitude: &area.Top[0], Latitude: &area.Top[1], TemperatureC: &weather.TemperatureTop, WindSpeedMs: &weather.WindSpeedTop, WindGustSpeedMs: &weather.GustWindpeedTop, ObservedAt: &observedAt}
 			observations = append(observations, observation)
+			if area.Bottom != nil {
+				id := "skistar-" + area.Id + "-bottom"
+				observation := lib.Observation{Id: &id, Longitude: &area.Bottom[0], Latitude: &area.Bottom[1], TemperatureC: &weather.TemperatureBottom, WindSpeedMs: &weather.WindSpeedBottom, WindGustSpeedMs: &weather.GustWindspeedBottom, ObservedAt: &observedAt}
+				observations = append(observations, observation)
+			}
 		}
-		if input.BottomLocation != nil {
-			id := "skistar-" + input.Id + "-bottom"
-			observation := lib.Observation{Id: &id, Latitude: &input.BottomLocation[0], Longitude: &input.BottomLocation[1], TemperatureC: &weather.TemperatureBottom, WindSpeedMs: &weather.GustWindspeedBottom, WindGustSpeedMs: &weather.GustWindspeedBottom}
-			observations = append(observations, observation)
+
+		// The &area parameter gives the same output within a ski destination
+		snow, err := scrapeSnow(ctx, resort.SnowUrl, areas)
+		if err != nil {
+			errs = append(errs, &lib.FetchError{Item: resort.Id + " snow", Err: err})
+			continue
 		}
+		refineObservationsWithSnow(observations, snow)
 	}
 
-	areAreas := []string{"areby", "hogzon", "duved", "bjornen"}
-	// The &area parameter gives the same output within a ski destination
-	areSnow := scrapeSnow("https://www.skistar.com/Lpv/SnowGraph?lang=sv&area=areby", areAreas)
-
-	vemdalenAreas := []string{"bjornrike", "vemdalsskalet", "klovsjostorhogna"}
-	vemdalenSnow := scrapeSnow("https://www.skistar.com/Lpv/SnowGraph?lang=sv&area=vemdalsskalet", vemdalenAreas)
-
-	refineObservationsWithSnow(observations, areSnow)
-	refineObservationsWithSnow(observations, vemdalenSnow)
+	// Skistar does not say how its values are checked
+	for i := range observations {
+		for _, property := range lib.MeasurementProperties {
+			if observations[i].Value(property) != nil {
+				observations[i].SetQuality(property, lib.QualityUnverified)
+			}
+		}
+	}
+	return observations, errors.Join(errs...)
+}
 
-	lib.UploadObservationsToFirestore(observations)
+// skistarObservedAt is the observation time of values fetched at now. The
+// pages show the current weather without a time, so the values are taken as
+// observed at the start of the hour. Runs within the same hour then share a
+// history point instead of appending identical ones.
+func skistarObservedAt(now time.Time) time.Time {
+	return now.UTC().Truncate(time.Hour)
 }
 
 func refineObservationsWithSnow(observations []lib.Observation, areSnow map[string]snowMeasurement) {
@@ -88,20 +107,33 @@ type weatherMeasurement struct {
 	GustWindspeedBottom float64
 }
 
-func scrapeCurrentWeather(url string) weatherMeasurement {
-	res, err := http.Get(url)
+// fetchDocument fetches and parses a web page.
+func fetchDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := lib.HTTPClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to fetch the webpage: %w", err)
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		log.Fatalf("Failed to fetch the webpage: %s", res.Status)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the webpage: %s", res.Status)
 	}
 
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to parse the webpage: %w", err)
+	}
+	return doc, nil
+}
+
+func scrapeCurrentWeather(ctx context.Context, url string) (weatherMeasurement, error) {
+	doc, err := fetchDocument(ctx, url)
+	if err != nil {
+		return weatherMeasurement{}, err
 	}
 
 	tempFields := doc.Find(".lpv-info-weather__text")
@@ -149,7 +181,7 @@ func scrapeCurrentWeather(url string) weatherMeasurement {
 		GustWindpeedTop:     gustWindpeedTop,
 		WindSpeedBottom:     bottomWindSpeed,
 		GustWindspeedBottom: gustWindspeedBottom,
-	}
+	}, nil
 }
 
 func extractFloat(element *goquery.Selection) (float64, error) {
@@ -168,20 +200,10 @@ type snowMeasurement struct {
 	NewSnow72hCm float64
 }
 
-func scrapeSnow(url string, areas []string) map[string]snowMeasurement {
-	res, err := http.Get(url)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		log.Fatalf("Failed to fetch the webpage: %s", res.Status)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+func scrapeSnow(ctx context.Context, url string, areas []string) (map[string]snowMeasurement, error) {
+	doc, err := fetchDocument(ctx, url)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	depthFields := doc.Find(".lpv-info-snow__value-number")
@@ -207,5 +229,5 @@ func scrapeSnow(url string, areas []string) map[string]snowMeasurement {
 
 		measurements[v] = snowMeasurement{SnowDepth: snowDepth, NewSnow24hCm: newSnow24h, NewSnow72hCm: newSnow72h}
 	}
-	return measurements
+	return measurements, nil
 }
@@ -3,174 +3,108 @@ package functions
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net/http"
-	"os"
-	"reflect"
 	"strconv"
+	"sync"
+	"time"
 
-	firebase "firebase.google.com/go"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
-	geojson "github.com/paulmach/go.geojson"
-	"google.golang.org/api/option"
+	"github.com/Yeetii/live-weather/lib"
 )
 
 func init() {
+	lib.RegisterProvider(smhiProvider{})
 	functions.HTTP("updateSmhi", UpdateSmhi)
 }
 
-const apiURL = "https://opendata-download-metobs.smhi.se/api/version/1.0/parameter/"
+type smhiProvider struct{}
 
-const (
-	MinLongitude = 11.91821627146622
-	MinLatitude  = 61.72869520035822
-	MaxLongitude = 18.493133525180227
-	MaxLatitude  = 64.42201973845242
-)
-
-func UpdateSmhi(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	var opts []option.ClientOption
-	if _, err := os.Stat("service-account.json"); err == nil {
-		opts = append(opts, option.WithCredentialsFile("service-account.json"))
-	}
-	conf := &firebase.Config{
-		DatabaseURL: "https://live-weather-eefc5.firebaseio.com",
-	}
-	app, err := firebase.NewApp(ctx, conf, opts...)
-	if err != nil {
-		log.Fatalf("error initializing app: %v", err)
-	}
-
-	firestoreClient, err := app.Firestore(ctx)
-	if err != nil {
-		log.Fatalf("error initializing Firestore client: %v", err)
-	}
-	defer firestoreClient.Close()
-
-	measurementIndices := []int{1, 3, 4, 21, 6, 8, 12}
-
-	observations := make([]Observation, 0)
-	for _, measurementIndex := range measurementIndices {
-		observations = append(observations, fetchMeasurement(w, measurementIndex)...)
-	}
-
-	observations = combineObservations(observations)
-
-	var features []geojson.Feature
-	for _, observation := range observations {
-		feature := geojson.NewPointFeature([]float64{*observation.Longitude, *observation.Latitude})
-		feature.ID = *observation.Id
-		feature.Properties = map[string]interface{}{
-			"name":              observation.Name,
-			"elevation":         observation.Elevation,
-			"temperature_c":     observation.TemperatureC,
-			"windSpeed_ms":      observation.WindSpeedMs,
-			"windDirection_deg": observation.WindDirectionDeg,
-			"windGustSpeed_ms":  observation.WindGustSpeedMs,
-			"humidity_percent":  observation.HumidityPercent,
-			"newSnow24h_cm":     nil,
-			"snowDepth_cm":      observation.SnowDepthCm,
-			"visibility_m":      observation.VisibilityM,
-		}
-		features = append(features, *feature)
-	}
-
-	for _, feature := range features {
-		id, ok := feature.ID.(string)
-		if !ok {
-			log.Fatal("feature.ID is not a string")
-		}
-
-		geoJsonBytes, marshalErr := feature.MarshalJSON()
-		if marshalErr != nil {
-			log.Printf("Failed to marshal feature: %v", marshalErr)
-			http.Error(w, "Failed to marshal feature", http.StatusInternalServerError)
-			return
-		}
+func (smhiProvider) Name() string {
+	return "smhi"
+}
 
-		var geoJsonMap map[string]interface{}
-		unmarshalErr := json.Unmarshal(geoJsonBytes, &geoJsonMap)
-		if unmarshalErr != nil {
-			log.Printf("Failed to unmarshal JSON into map: %v", unmarshalErr)
-			http.Error(w, "Failed to process JSON", http.StatusInternalServerError)
-			return
-		}
+// missingMeasurement is a station the station set had no latest-hour value for.
+type missingMeasurement struct {
+	measurementIndex int
+	stationKey       string
+	observation      lib.Observation
+}
 
-		_, err := firestoreClient.Collection("weatherObservations").Doc(id).Set(ctx, geoJsonMap)
+// Fetch requests the latest hour of every station in one station set request
+// per parameter, only stations without a value in the last hour are requested
+// one by one for their latest day.
+func (smhiProvider) Fetch(ctx context.Context) ([]lib.Observation, error) {
+	settings := appConfig.Providers.Smhi
+	measurementIndices := settings.Parameters
+
+	var mu sync.Mutex
+	var observations []lib.Observation
+	var missing []missingMeasurement
+	var errs []error
+	err := lib.ForEach(ctx, len(measurementIndices), measurementIndices, func(ctx context.Context, measurementIndex int) error {
+		fetchUrl := fmt.Sprintf("%v%v/station-set/all/period/latest-hour/data.json", settings.ApiUrl, measurementIndex)
+		stationSet, err := fetchFromApi[StationSetMeasurement](ctx, fetchUrl)
 		if err != nil {
-			log.Printf("Failed to store document: %v", err)
-			http.Error(w, "Failed to store data in Firestore", http.StatusInternalServerError)
-			return
+			mu.Lock()
+			errs = append(errs, &lib.FetchError{Item: fmt.Sprintf("parameter %v", measurementIndex), Err: err})
+			mu.Unlock()
+			return nil
 		}
-	}
-
-	log.Println("Data successfully fetched and stored in Firestore.")
-	fmt.Fprintln(w, "Data successfully fetched and stored in Firestore.")
-}
 
-func combineObservations(observations []Observation) []Observation {
-	combinedObservations := make(map[string]Observation)
-	for _, observation := range observations {
-		if _, ok := combinedObservations[*observation.Id]; !ok {
-			combinedObservations[*observation.Id] = observation
-		} else {
-			existingObservation := combinedObservations[*observation.Id]
-			reflectExisting := reflect.ValueOf(&existingObservation).Elem() // Note the & and.Elem()
-			reflectObservation := reflect.ValueOf(observation)
-
-			for i := 0; i < reflectObservation.NumField(); i++ {
-				field := reflectObservation.Field(i)
-				targetField := reflectExisting.Field(i)
-				fieldType := reflectObservation.Type().Field(i)
-
-				if targetField.Kind() == reflect.Ptr && targetField.IsNil() && !field.IsNil() {
-					if targetField.CanSet() { // This should now be true
-						if field.Elem().IsValid() {
-							targetField.Set(field) // No need for.Elem() here since both are pointers
-						} else {
-							log.Printf("Field %s's dereferenced value is not valid. Value %v, dereferenced: %v", fieldType.Name, field, field.Elem())
-						}
-					} else {
-						log.Printf("Field %s cannot be set", fieldType.Name)
-					}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, station := range stationSet.Station {
+			if _, ok := activeRegions.Locate(station.Longitude, station.Latitude); !ok {
+				continue
+			}
+			observation := newStationObservation(station.Key, station.Name, station.Height, station.Latitude, station.Longitude)
+			if len(station.Value) == 0 {
+				// Stations that have not reported for a day are closed or broken
+				if time.Since(time.UnixMilli(station.To)) > 24*time.Hour {
+					continue
 				}
+				missing = append(missing, missingMeasurement{measurementIndex: measurementIndex, stationKey: station.Key, observation: observation})
+				continue
+			}
+			if err := setMeasurementValue(&observation, measurementIndex, station.Value); err != nil {
+				errs = append(errs, &lib.FetchError{Item: "station " + station.Key, Err: err})
+				continue
 			}
-			combinedObservations[*observation.Id] = existingObservation // Update the map with the modified struct
+			observations = append(observations, observation)
 		}
-	}
-	// Convert map to slice as before
-	combinedObservationsSlice := make([]Observation, 0, len(combinedObservations))
-	for _, observation := range combinedObservations {
-		combinedObservationsSlice = append(combinedObservationsSlice, observation)
-	}
-	return combinedObservationsSlice
-}
-
-func fetchMeasurement(w http.ResponseWriter, measurement int) []Observation {
-	stations, err := getStations(measurement)
+		return nil
+	})
 	if err != nil {
-		log.Fatalf("error getting stations: %v", err)
-		http.Error(w, "error getting stations", http.StatusInternalServerError)
+		return observations, errors.Join(append(errs, err)...)
 	}
-	stations = filterStations(stations)
 
-	var observations []Observation
-	for _, station := range stations {
-		observation, err := getObservation(measurement, station.ID)
+	log.Printf("Requesting latest day of %d SMHI station measurements missing the latest hour", len(missing))
+	err = lib.ForEach(ctx, settings.Workers, missing, func(ctx context.Context, job missingMeasurement) error {
+		observation, err := getLatestDayObservation(ctx, job)
+		mu.Lock()
+		defer mu.Unlock()
 		if err != nil {
-			log.Printf("error getting observation for station %s: %v", station.Name, err)
-			continue
+			errs = append(errs, &lib.FetchError{Item: "station " + job.stationKey, Err: err})
+			return nil
 		}
 		if observation != nil {
 			observations = append(observations, *observation)
 		}
+		return nil
+	})
+	if err != nil {
+		return observations, errors.Join(append(errs, err)...)
 	}
-	return observations
+	return observations, errors.Join(errs...)
+}
+
+func UpdateSmhi(w http.ResponseWriter, r *http.Request) {
+	ingestProvider(w, r, "smhi")
 }
 
 func getZero[T any]() T {
@@ -178,13 +112,21 @@ func getZero[T any]() T {
 	return result
 }
 
-func fetchFromApi[T any](url string) (T, error) {
-	resp, err := http.Get(url)
+func fetchFromApi[T any](ctx context.Context, url string) (T, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.Fatalf("Failed to make the request: %v", err)
+		return getZero[T](), err
+	}
+	resp, err := lib.HTTPClient.Do(req)
+	if err != nil {
+		return getZero[T](), fmt.Errorf("failed to make the request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return getZero[T](), fmt.Errorf("bad status: %s", resp.Status)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Failed to read the response body: %v", err)
@@ -200,7 +142,31 @@ func fetchFromApi[T any](url string) (T, error) {
 	return object, nil
 }
 
-func setValue(observation *Observation, value *float64, measureMentindex int) {
+// measurementProperties maps SMHI parameter indices to observation property names.
+var measurementProperties = map[int]string{
+	1:  "temperature_c",
+	3:  "windDirection_deg",
+	4:  "windSpeed_ms",
+	6:  "humidity_percent",
+	8:  "snowDepth_cm",
+	12: "visibility_m",
+	21: "windGustSpeed_ms",
+}
+
+// qualityFlag translates SMHI quality codes, G is controlled and approved and
+// Y is suspected or aggregated.
+func qualityFlag(quality string) lib.QualityFlag {
+	switch quality {
+	case "G":
+		return lib.QualityGood
+	case "Y":
+		return lib.QualitySuspect
+	default:
+		return lib.QualityUnverified
+	}
+}
+
+func setValue(observation *lib.Observation, value *float64, measureMentindex int) {
 	switch measureMentindex {
 	case 1:
 		observation.TemperatureC = value
@@ -223,162 +189,93 @@ func setValue(observation *Observation, value *float64, measureMentindex int) {
 	}
 }
 
-func getObservation(measurementIndex int, stationID int) (*Observation, error) {
-	fetchUrl := fmt.Sprintf("%v%v/station/%v/period/latest-hour/data.json", apiURL, measurementIndex, stationID)
-	measurement, err := fetchFromApi[Measurement](fetchUrl)
-	if err != nil {
-		log.Printf("Failed to fetch measurement on %v: %v", fetchUrl, err)
-		return nil, err
-	}
-
-	var elevation float64
-	var lat float64
-	var lon float64
-
-	if len(measurement.Position) > 0 {
-		elevation = measurement.Position[0].Height
-		lat = measurement.Position[0].Latitude
-		lon = measurement.Position[0].Longitude
-	}
-
-	id := "smhi-" + measurement.Station.Key
-	name := measurement.Station.Name
-
-	observation := Observation{
+func newStationObservation(key string, name string, elevation float64, lat float64, lon float64) lib.Observation {
+	id := "smhi-" + key
+	return lib.Observation{
 		Id:        &id,
 		Elevation: &elevation,
 		Latitude:  &lat,
 		Longitude: &lon,
 		Name:      &name,
 	}
+}
 
-	if len(measurement.Value) == 0 {
-		fetchUrl := fmt.Sprintf("%v%v/station/%v/period/latest-day/data.json", apiURL, measurementIndex, stationID)
-		daylyMeasurement, err := fetchFromApi[Measurement](fetchUrl)
-		if err != nil {
-			log.Printf("Failed to fetch measurement on %v: %v", fetchUrl, err)
-			return nil, err
-		}
-		measurement = daylyMeasurement
-	}
-
-	if len(measurement.Value) > 0 {
-		value := measurement.Value[0].Value
-		floatValue, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			log.Printf("Failed to parse value: %v", err)
-			return nil, err
+// setMeasurementValue sets the most recent of the values on the observation.
+func setMeasurementValue(observation *lib.Observation, measurementIndex int, values []MeasurementValue) error {
+	latest := values[0]
+	for _, value := range values[1:] {
+		if value.Date > latest.Date {
+			latest = value
 		}
-		setValue(&observation, &floatValue, measurementIndex)
-	} else {
-		return nil, nil
 	}
 
-	return &observation, nil
-}
-
-func getStations(measurementIndex int) ([]Station, error) {
-	resp, err := http.Get(fmt.Sprintf("%v%v.json", apiURL, measurementIndex))
+	floatValue, err := strconv.ParseFloat(latest.Value, 64)
 	if err != nil {
-		log.Fatalf("Failed to make the request: %v", err)
+		return fmt.Errorf("failed to parse value: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read the response body: %v", err)
-		return []Station{}, err
+	setValue(observation, &floatValue, measurementIndex)
+	if property, ok := measurementProperties[measurementIndex]; ok {
+		observation.SetQuality(property, qualityFlag(latest.Quality))
 	}
+	observedAt := time.UnixMilli(latest.Date).UTC()
+	observation.ObservedAt = &observedAt
+	return nil
+}
 
-	var tempStations Stations
-	err = json.Unmarshal(body, &tempStations)
+func getLatestDayObservation(ctx context.Context, job missingMeasurement) (*lib.Observation, error) {
+	fetchUrl := fmt.Sprintf("%v%v/station/%v/period/latest-day/data.json", appConfig.Providers.Smhi.ApiUrl, job.measurementIndex, job.stationKey)
+	measurement, err := fetchFromApi[Measurement](ctx, fetchUrl)
 	if err != nil {
-		log.Printf("Failed to parse API response: %v", err)
-		return []Station{}, err
+		return nil, fmt.Errorf("failed to fetch measurement on %v: %w", fetchUrl, err)
 	}
-	return tempStations.Station, nil
-}
-
-func withinBoundingBox(station Station) bool {
-	return station.Longitude >= MinLongitude &&
-		station.Longitude <= MaxLongitude &&
-		station.Latitude >= MinLatitude &&
-		station.Latitude <= MaxLatitude
-}
-
-func filterStations(stations []Station) []Station {
-	var filteredStations []Station
-	for _, station := range stations {
-		if station.Active && withinBoundingBox(station) {
-			filteredStations = append(filteredStations, station)
-		}
+	if len(measurement.Value) == 0 {
+		return nil, nil
 	}
-	return filteredStations
-}
 
-type Observation struct {
-	Id               *string  `json:"id"`
-	Name             *string  `json:"name"`
-	Latitude         *float64 `json:"latitude"`
-	Longitude        *float64 `json:"longitude"`
-	Elevation        *float64 `json:"elevation"`
-	TemperatureC     *float64 `json:"temperature_c"`
-	WindSpeedMs      *float64 `json:"windSpeed_ms"`
-	WindDirectionDeg *float64 `json:"windDirection_deg"`
-	WindGustSpeedMs  *float64 `json:"windGustSpeed_ms"`
-	HumidityPercent  *float64 `json:"humidity_percent"`
-	NewSnow24hCm     *float64 `json:"newSnow24h_cm"`
-	SnowDepthCm      *float64 `json:"snowDepth_cm"`
-	VisibilityM      *float64 `json:"visibility_m"`
+	observation := job.observation
+	if err := setMeasurementValue(&observation, job.measurementIndex, measurement.Value); err != nil {
+		return nil, err
+	}
+	return &observation, nil
 }
 
-type Station struct {
-	Key     string `json:"key"`
-	Updated int64  `json:"updated"`
-	Title   string `json:"title"`
-	Summary string `json:"summary"`
-	Link    []struct {
-		Href string `json:"href"`
-		Rel  string `json:"rel"`
-		Type string `json:"type"`
-	} `json:"link"`
-	Name              string  `json:"name"`
-	Owner             string  `json:"owner"`
-	OwnerCategory     string  `json:"ownerCategory"`
-	MeasuringStations string  `json:"measuringStations"`
-	ID                int     `json:"id"`
-	Height            float64 `json:"height"`
-	Latitude          float64 `json:"latitude"`
-	Longitude         float64 `json:"longitude"`
-	Active            bool    `json:"active"`
-	From              int64   `json:"from"`
-	To                int64   `json:"to"`
+// MeasurementValue is a single value of a parameter. Value is a decimal string.
+type MeasurementValue struct {
+	Date    int64  `json:"date"`
+	Value   string `json:"value"`
+	Quality string `json:"quality"`
 }
 
-type Stations struct {
-	Key       string `json:"key"`
-	Updated   int64  `json:"updated"`
-	Title     string `json:"title"`
-	Summary   string `json:"summary"`
-	Unit      string `json:"unit"`
-	ValueType string `json:"valueType"`
-	Link      []struct {
-		Href string `json:"href"`
-		Rel  string `json:"rel"`
-		Type string `json:"type"`
-	} `json:"link"`
-	StationSet []struct {
+// StationSetMeasurement is the latest value of a parameter for every station,
+// returned by station-set/all/period/latest-hour/data.json.
+type StationSetMeasurement struct {
+	Updated   int64 `json:"updated"`
+	Parameter struct {
 		Key     string `json:"key"`
-		Updated int64  `json:"updated"`
-		Title   string `json:"title"`
+		Name    string `json:"name"`
 		Summary string `json:"summary"`
-		Link    []struct {
-			Href string `json:"href"`
-			Rel  string `json:"rel"`
-			Type string `json:"type"`
-		} `json:"link"`
-	} `json:"stationSet"`
-	Station []Station `json:"station"`
+		Unit    string `json:"unit"`
+	} `json:"parameter"`
+	Period struct {
+		Key      string `json:"key"`
+		From     int64  `json:"from"`
+		To       int64  `json:"to"`
+		Summary  string `json:"summary"`
+		Sampling string `json:"sampling"`
+	} `json:"period"`
+	Station []struct {
+		Key               string             `json:"key"`
+		Name              string             `json:"name"`
+		Owner             string             `json:"owner"`
+		OwnerCategory     string             `json:"ownerCategory"`
+		MeasuringStations string             `json:"measuringStations"`
+		From              int64              `json:"from"`
+		To                int64              `json:"to"`
+		Height            float64            `json:"height"`
+		Latitude          float64            `json:"latitude"`
+		Longitude         float64            `json:"longitude"`
+		Value             []MeasurementValue `json:"value"`
+	} `json:"station"`
 }
 
 type Measurement struct {
@@ -416,9 +313,5 @@ type Measurement struct {
 		Rel  string `json:"rel"`
 		Type string `json:"type"`
 	} `json:"link"`
-	Value []struct {
-		Date    int64  `json:"date"`
-		Value   string `json:"value"`
-		Quality string `json:"quality"`
-	} `json:"value"`
+	Value []MeasurementValue `json:"value"`
 }
@@ -0,0 +1,141 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+// serveSmhiFixtures serves testdata/smhi/{parameter}-latest-hour.json for the
+// station sets and {parameter}-{station}-latest-day.json for single stations,
+// other paths are not found. It returns the requested paths.
+func serveSmhiFixtures(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		var name string
+		switch {
+		case len(segments) == 6 && segments[1] == "station-set" && segments[4] == "latest-hour":
+			name = segments[0] + "-latest-hour.json"
+		case len(segments) == 6 && segments[1] == "station" && segments[4] == "latest-day":
+			name = segments[0] + "-" + segments[2] + "-latest-day.json"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "smhi", name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requested)
+	}
+}
+
+func TestSmhiFetch(t *testing.T) {
+	server, requested := serveSmhiFixtures(t)
+	settings := appConfig.Providers.Smhi
+	t.Cleanup(func() { appConfig.Providers.Smhi = settings })
+	appConfig.Providers.Smhi.ApiUrl = server.URL + "/"
+	// Parameter 4 has no fixture, its station set fails
+	appConfig.Providers.Smhi.Parameters = []int{1, 8, 4}
+
+	observations, err := smhiProvider{}.Fetch(context.Background())
+
+	at := func(hour int) time.Time {
+		return time.Date(2024, 12, 1, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		id         string
+		property   string
+		value      float64
+		observedAt time.Time
+		quality    lib.QualityFlag
+	}{
+		{"latest value of the station set", "smhi-134590", "temperature_c", -3.4, at(12), lib.QualityGood},
+		{"snow depth in centimetres", "smhi-134590", "snowDepth_cm", 45, at(12), lib.QualityGood},
+		{"latest value of the latest day", "smhi-134110", "temperature_c", -5.1, at(11), lib.QualitySuspect},
+	}
+	if len(observations) != len(tests) {
+		t.Errorf("got %d observations, want %d", len(observations), len(tests))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index := slices.IndexFunc(observations, func(observation lib.Observation) bool {
+				return *observation.Id == test.id && observation.Value(test.property) != nil
+			})
+			if index < 0 {
+				t.Fatalf("no %s of %s", test.property, test.id)
+			}
+			observation := observations[index]
+			if value := *observation.Value(test.property); value != test.value {
+				t.Errorf("%s = %v, want %v", test.property, value, test.value)
+			}
+			if observation.ObservedAt == nil || !observation.ObservedAt.Equal(test.observedAt) {
+				t.Errorf("observed at %v, want %v", observation.ObservedAt, test.observedAt)
+			}
+			if quality := observation.Quality[test.property]; quality != test.quality {
+				t.Errorf("quality %s, want %s", quality, test.quality)
+			}
+			if observation.Elevation == nil || observation.Latitude == nil || observation.Name == nil {
+				t.Errorf("the station position or name is missing: %+v", observation)
+			}
+		})
+	}
+
+	var items []string
+	for _, item := range lib.ItemErrors(err) {
+		items = append(items, item.Item)
+	}
+	slices.Sort(items)
+	// Östersund has an empty temperature and no latest day of snow depth
+	want := []string{"parameter 4", "station 134400", "station 134400"}
+	if !slices.Equal(items, want) {
+		t.Errorf("failed items %v, want %v from %v", items, want, err)
+	}
+	var fetchErr *lib.FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Errorf("want the failures as FetchErrors, got %v", err)
+	}
+
+	// Only the stations in an active region without a value in the last hour
+	// are requested one by one, not Abisko outside or Krokom closed since 2010
+	var stationRequests []string
+	for _, path := range requested() {
+		if strings.Contains(path, "/station/") {
+			stationRequests = append(stationRequests, path)
+		}
+	}
+	slices.Sort(stationRequests)
+	wantRequests := []string{
+		"/1/station/134110/period/latest-day/data.json",
+		"/8/station/134110/period/latest-day/data.json",
+		"/8/station/134400/period/latest-day/data.json",
+	}
+	if !slices.Equal(stationRequests, wantRequests) {
+		t.Errorf("requested %v, want %v", stationRequests, wantRequests)
+	}
+}
@@ -4,20 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	firebase "firebase.google.com/go"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
-	geojson "github.com/paulmach/go.geojson"
-	"google.golang.org/api/option"
+	"github.com/Yeetii/live-weather/lib"
 )
 
 func init() {
+	lib.RegisterProvider(trafikverketProvider{})
 	functions.HTTP("updateTrafikverket", UpdateTrafikverket)
 }
 
@@ -27,37 +27,19 @@ func parseCoordinate(coordinate string) []float64 {
 	return []float64{lon, lat}
 }
 
-// Firebase Function to fetch from Trafikverket API and store in Firestore
-func UpdateTrafikverket(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	var opts []option.ClientOption
-	if _, err := os.Stat("service-account.json"); err == nil {
-		opts = append(opts, option.WithCredentialsFile("service-account.json"))
-	}
-	conf := &firebase.Config{
-		DatabaseURL: "https://live-weather-eefc5.firebaseio.com",
-	}
-	app, err := firebase.NewApp(ctx, conf, opts...)
-	if err != nil {
-		log.Fatalf("error initializing app: %v", err)
-	}
+type trafikverketProvider struct{}
 
-	// Initialize Firestore client
-	firestoreClient, err := app.Firestore(ctx)
-	if err != nil {
-		log.Fatalf("error initializing Firestore client: %v", err)
-	}
-	defer firestoreClient.Close()
+func (trafikverketProvider) Name() string {
+	return "trafikverket"
+}
 
+func (trafikverketProvider) Fetch(ctx context.Context) ([]lib.Observation, error) {
 	authKey := os.Getenv("TRAFIKVERKET_AUTH_KEY")
 	if authKey == "" {
-		http.Error(w, "TRAFIKVERKET_AUTH_KEY not set in environment", http.StatusInternalServerError)
-		return
+		return nil, errors.New("TRAFIKVERKET_AUTH_KEY not set in environment")
 	}
 
-	// Fetch data from Trafikverket API
-	apiURL := "https://api.trafikinfo.trafikverket.se/v2/data.json"
+	settings := appConfig.Providers.Trafikverket
 
 	// Define the XML payload
 	xmlData := fmt.Sprintf(`
@@ -65,88 +47,108 @@ func UpdateTrafikverket(w http.ResponseWriter, r *http.Request) {
 		<LOGIN authenticationkey="%s" />
 		<QUERY objecttype="WeatherMeasurepoint" schemaversion="2.1">
 			<FILTER>
-				<WITHIN name="Geometry.SWEREF99TM" shape="box" value="311863 6858375, 552124 7169867"/>
+				<OR>%s
+				</OR>
 			</FILTER>
 		</QUERY>
-	</REQUEST>`, authKey)
+	</REQUEST>`, authKey, regionFilters(activeRegions))
 
 	// Make the POST request
-	resp, err := http.Post(apiURL, "application/xml", bytes.NewBuffer([]byte(xmlData)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.ApiUrl, bytes.NewBuffer([]byte(xmlData)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	resp, err := lib.HTTPClient.Do(req)
 	if err != nil {
-		log.Fatalf("Failed to make the request: %v", err)
+		return nil, fmt.Errorf("failed to make the request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "Failed to read API response", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to read API response: %w", err)
 	}
 
 	var trafikData TrafikverketAPIResponse
 	err = json.Unmarshal(body, &trafikData)
 	if err != nil {
-		log.Printf("Failed to parse API response: %v", err)
-		http.Error(w, "Failed to parse API response", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to parse API response: %w", err)
 	}
 
-	// Map trafikData into geojson features
-	var features []geojson.Feature
+	var observations []lib.Observation
 	for _, result := range trafikData.RESPONSE.RESULT {
 		for _, measurepoint := range result.WeatherMeasurepoint {
 			coordinate := parseCoordinate(measurepoint.Geometry.WGS84)
-			feature := geojson.NewPointFeature(coordinate)
-			feature.ID = "trafikverket-" + measurepoint.ID
-			feature.Properties = map[string]interface{}{
-				"name":              measurepoint.Name,
-				"elevation":         nil,
-				"temperature_c":     measurepoint.Observation.Air.Temperature.Value,
-				"windSpeed_ms":      measurepoint.Observation.Wind[0].Speed.Value,
-				"windDirection_deg": measurepoint.Observation.Wind[0].Direction.Value,
-				"windGustSpeed_ms":  nil,
-				"humidity_percent":  measurepoint.Observation.Air.RelativeHumidity.Value,
-				"newSnow24h_cm":     nil,
-				"snowDepth_cm":      nil,
-				"visibility_m":      measurepoint.Observation.Air.VisibleDistance.Value,
+			id := "trafikverket-" + measurepoint.ID
+			name := measurepoint.Name
+			temperature := measurepoint.Observation.Air.Temperature.Value
+			humidity := measurepoint.Observation.Air.RelativeHumidity.Value
+			visibility := measurepoint.Observation.Air.VisibleDistance.Value
+			observation := lib.Observation{
+				Id:              &id,
+				Name:            &name,
+				Longitude:       &coordinate[0],
+				Latitude:        &coordinate[1],
+				TemperatureC:    &temperature,
+				HumidityPercent: &humidity,
+				VisibilityM:     &visibility,
+			}
+			air := measurepoint.Observation.Air
+			observation.SetQuality("temperature_c", trafikverketQuality(air.Temperature.Origin))
+			observation.SetQuality("humidity_percent", trafikverketQuality(air.RelativeHumidity.Origin))
+			observation.SetQuality("visibility_m", trafikverketQuality(air.VisibleDistance.Origin))
+			if !measurepoint.Observation.Sample.IsZero() {
+				observedAt := measurepoint.Observation.Sample.UTC()
+				observation.ObservedAt = &observedAt
 			}
-			features = append(features, *feature)
+			if len(measurepoint.Observation.Wind) > 0 {
+				windSpeed := measurepoint.Observation.Wind[0].Speed.Value
+				windDirection := measurepoint.Observation.Wind[0].Direction.Value
+				observation.WindSpeedMs = &windSpeed
+				observation.WindDirectionDeg = &windDirection
+				observation.SetQuality("windSpeed_ms", trafikverketQuality(measurepoint.Observation.Wind[0].Speed.Origin))
+				observation.SetQuality("windDirection_deg", trafikverketQuality(measurepoint.Observation.Wind[0].Direction.Origin))
+			}
+			observations = append(observations, observation)
 		}
 	}
+	return observations, nil
+}
 
-	// Store each WeatherMeasurepoint in Firestore
-	for _, feature := range features {
-		id, ok := feature.ID.(string)
-		if !ok {
-			log.Fatal("feature.ID is not a string")
-		}
-
-		geoJsonBytes, marshalErr := feature.MarshalJSON()
-		if marshalErr != nil {
-			log.Printf("Failed to marshal feature: %v", marshalErr)
-			http.Error(w, "Failed to marshal feature", http.StatusInternalServerError)
-			return
-		}
-
-		var geoJsonMap map[string]interface{}
-		unmarshalErr := json.Unmarshal(geoJsonBytes, &geoJsonMap)
-		if unmarshalErr != nil {
-			log.Printf("Failed to unmarshal JSON into map: %v", unmarshalErr)
-			http.Error(w, "Failed to process JSON", http.StatusInternalServerError)
-			return
-		}
+// trafikverketQuality flags a value by its Origin. Trafikverket does not
+// publish whether measured values are checked, calculated values are derived
+// from other sensors and less reliable.
+func trafikverketQuality(origin string) lib.QualityFlag {
+	if strings.EqualFold(origin, "calculated") || strings.EqualFold(origin, "estimated") {
+		return lib.QualitySuspect
+	}
+	return lib.QualityUnverified
+}
 
-		_, err := firestoreClient.Collection("weatherObservations").Doc(id).Set(ctx, geoJsonMap)
-		if err != nil {
-			log.Printf("Failed to store document: %v", err)
-			http.Error(w, "Failed to store data in Firestore", http.StatusInternalServerError)
-			return
+// regionFilters returns a WITHIN filter per polygon of the regions, using its
+// outline. Points in holes are dropped by the pipeline.
+func regionFilters(regions lib.Regions) string {
+	var filters strings.Builder
+	for _, region := range regions {
+		for _, polygon := range region.Area {
+			points := make([]string, len(polygon[0]))
+			for i, point := range polygon[0] {
+				points[i] = fmt.Sprintf("%f %f", point[0], point[1])
+			}
+			fmt.Fprintf(&filters, "\n\t\t\t\t\t<WITHIN name=\"Geometry.WGS84\" shape=\"polygon\" value=\"%s\"/>", strings.Join(points, ", "))
 		}
 	}
+	return filters.String()
+}
 
-	// Send a success response
-	fmt.Fprintln(w, "Data successfully fetched and stored in Firestore.")
-
+// Firebase Function to fetch from Trafikverket API and store in Firestore
+func UpdateTrafikverket(w http.ResponseWriter, r *http.Request) {
+	ingestProvider(w, r, "trafikverket")
 }
 
 type TrafikverketAPIResponse struct {
@@ -0,0 +1,24 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func TestTrafikverketQuality(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   lib.QualityFlag
+	}{
+		{"measured", lib.QualityUnverified},
+		{"", lib.QualityUnverified},
+		{"calculated", lib.QualitySuspect},
+		{"Estimated", lib.QualitySuspect},
+	}
+	for _, test := range tests {
+		if got := trafikverketQuality(test.origin); got != test.want {
+			t.Errorf("trafikverketQuality(%q) = %s, want %s", test.origin, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	if appConfig.WebcamObservations {
+		lib.RegisterProvider(webcamProvider{})
+		functions.HTTP("updateWebcamObservations", updateWebcamObservations)
+	}
+}
+
+func updateWebcamObservations(w http.ResponseWriter, r *http.Request) {
+	ingestProvider(w, r, "webcams")
+}
+
+// webcamProvider turns the visibility score of the latest image of every
+// healthy webcam into an observation at the camera. Dark, stale and broken
+// webcams are left out.
+type webcamProvider struct{}
+
+func (webcamProvider) Name() string {
+	return "webcams"
+}
+
+type webcamSite struct {
+	fileName string
+	name     string
+	location []float64
+}
+
+func (webcamProvider) Fetch(ctx context.Context) ([]lib.Observation, error) {
+	store, err := lib.OpenImageStore(ctx, lib.LoadStoreConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	var sites []webcamSite
+	for _, webcam := range appConfig.Webcams {
+		sites = append(sites, webcamSite{webcamFileName(webcam.Id), webcam.Name, webcam.Location})
+	}
+	for _, webcam := range appConfig.SkistarWebcams {
+		sites = append(sites, webcamSite{skistarWebcamFileName(webcam.Id), webcam.Name, webcam.Location})
+	}
+
+	now := time.Now().UTC()
+	var observations []lib.Observation
+	var errs []error
+	for _, site := range sites {
+		latest, err := store.Stat(ctx, site.fileName)
+		if errors.Is(err, lib.ErrImageNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, &lib.FetchError{Item: site.fileName, Err: err})
+			continue
+		}
+		if health, _ := webcamHealthPolicy.Health(latest.Metadata, now); health != lib.HealthOK {
+			continue
+		}
+		visibility, err := strconv.ParseFloat(latest.Metadata["visibility"], 64)
+		if err != nil {
+			// Images stored before the stats were measured
+			continue
+		}
+		capturedAt, err := time.Parse(time.RFC3339, latest.Metadata["capturedAt"])
+		if err != nil {
+			errs = append(errs, &lib.FetchError{Item: site.fileName, Err: err})
+			continue
+		}
+
+		id := lib.WebcamName(site.fileName)
+		observation := lib.Observation{Id: &id, Longitude: &site.location[0], Latitude: &site.location[1], VisibilityScore: &visibility, ObservedAt: &capturedAt}
+		if site.name != "" {
+			observation.Name = &site.name
+		}
+		observation.SetQuality("visibilityScore", lib.QualityUnverified)
+		observations = append(observations, observation)
+	}
+	return observations, errors.Join(errs...)
+}
@@ -0,0 +1,39 @@
+package functions
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("updateWebcamTimelapses", UpdateWebcamTimelapses)
+}
+
+// UpdateWebcamTimelapses regenerates the animated GIF of the last 24 hours of
+// every configured webcam. It is meant to be run on a schedule, e.g. hourly.
+func UpdateWebcamTimelapses(w http.ResponseWriter, r *http.Request) {
+	store, err := lib.OpenImageStore(r.Context(), lib.LoadStoreConfig())
+	if err != nil {
+		log.Printf("Failed to open image store: %v", err)
+		http.Error(w, "Failed to open image store", http.StatusInternalServerError)
+		return
+	}
+	defer store.Close()
+
+	report := lib.NewRunReport()
+	now := time.Now().UTC()
+	for _, name := range webcamNames() {
+		frames, err := lib.UpdateWebcamTimelapse(r.Context(), store, name, now)
+		if err != nil {
+			log.Printf("Failed to update timelapse of %s: %v", name, err)
+			report.Add(name, 0, &lib.FetchError{Item: name, Err: err})
+			continue
+		}
+		report.Add(name, frames, nil)
+	}
+	writeRunReport(w, report)
+}
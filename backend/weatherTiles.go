@@ -0,0 +1,94 @@
+package functions
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/Yeetii/live-weather/lib"
+)
+
+func init() {
+	functions.HTTP("weatherTiles", WeatherTiles)
+}
+
+type rasterLayer struct {
+	Property string
+	Ramp     lib.ColorRamp
+}
+
+var rasterLayers = map[string]rasterLayer{
+	"temperature": {Property: "temperature_c", Ramp: lib.TemperatureRamp},
+	"wind":        {Property: "windSpeed_ms", Ramp: lib.WindSpeedRamp},
+	"snow":        {Property: "snowDepth_cm", Ramp: lib.SnowDepthRamp},
+}
+
+// rasterTileCells is the resolution of the grid interpolated for each tile,
+// pixels in between are sampled bilinearly.
+const rasterTileCells = 64
+
+// WeatherTiles serves interpolated fields as colored XYZ PNG tiles at
+// /weatherTiles/{layer}/{z}/{x}/{y}.png, where layer is temperature, wind or snow.
+// The observation filters of fetchObservations apply, the observations are
+// shared with the vector tiles, see loadCachedObservations.
+func WeatherTiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	tile, err := lib.ParseTilePath(r.URL.Path, ".png")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 4 {
+		http.Error(w, "path must be /{layer}/{z}/{x}/{y}.png", http.StatusBadRequest)
+		return
+	}
+	layerName := segments[len(segments)-4]
+	layer, ok := rasterLayers[layerName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown layer %q", layerName), http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseObservationFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	observations, err := loadCachedObservations(r.Context(), gridFilter(filter, layer.Property))
+	if err != nil {
+		log.Printf("Failed to load observations: %v", err)
+		http.Error(w, "Failed to load observations", http.StatusInternalServerError)
+		return
+	}
+	grid, err := interpolateGrid(observations, layer.Property, tile.Bounds(), rasterTileCells, rasterTileCells)
+	if err != nil {
+		log.Printf("Failed to build %s grid: %v", layer.Property, err)
+		http.Error(w, "Failed to build grid", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := lib.EncodePNG(lib.RenderTile(grid, tile, layer.Ramp))
+	if err != nil {
+		log.Printf("Failed to render tile: %v", err)
+		http.Error(w, "Failed to render tile", http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha1.Sum(data)
+	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}